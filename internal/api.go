@@ -0,0 +1,569 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"github.com/gorilla/mux"
+)
+
+// JSON API mirroring the web UI operations.
+//
+// Buckets are identified by the "bucket" URL query parameter (encoded path, as in the web UI).
+// Keys and values are represented as text by default,
+// the "key_encoding" and "value_encoding" URL query parameters can be used to select another encoding
+// (for both request and response bodies).
+func (s *Server) registerAPIRoutes(router *mux.Router) {
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/db", handleAPIGetDBInfo(s)).Methods(http.MethodGet)
+	api.HandleFunc("/buckets", handleAPIListBuckets(s)).Methods(http.MethodGet)
+	api.HandleFunc("/buckets", handleAPICreateBucket(s)).Methods(http.MethodPost)
+	api.HandleFunc("/buckets", handleAPIDeleteBucket(s)).Methods(http.MethodDelete)
+	api.HandleFunc("/buckets/truncate", handleAPITruncateBucket(s)).Methods(http.MethodPost)
+	api.HandleFunc("/buckets/rename", handleAPICopyBucket(s, false)).Methods(http.MethodPost)
+	api.HandleFunc("/buckets/copy", handleAPICopyBucket(s, true)).Methods(http.MethodPost)
+	api.HandleFunc("/rows", handleAPIGetRow(s)).Methods(http.MethodGet)
+	api.HandleFunc("/rows", handleAPIPutRow(s)).Methods(http.MethodPut)
+	api.HandleFunc("/rows", handleAPIDeleteRow(s)).Methods(http.MethodDelete)
+	api.HandleFunc("/rows/range", handleAPIDeleteRowRange(s)).Methods(http.MethodDelete)
+	api.HandleFunc("/rows/page", handleAPIReadRowPage(s)).Methods(http.MethodGet)
+	api.HandleFunc("/rows/move", handleAPIMoveRow(s, false)).Methods(http.MethodPost)
+	api.HandleFunc("/rows/copy", handleAPIMoveRow(s, true)).Methods(http.MethodPost)
+	api.HandleFunc("/search", handleAPISearch(s)).Methods(http.MethodGet)
+	api.HandleFunc("/search/bulk", handleAPISearchBulk(s)).Methods(http.MethodPost)
+	api.HandleFunc("/export", handleAPIExport(s)).Methods(http.MethodGet)
+	api.HandleFunc("/import", handleAPIImport(s)).Methods(http.MethodPost)
+	api.HandleFunc("/backup", handleAPIBackup(s)).Methods(http.MethodGet)
+	api.HandleFunc("/compact", handleAPICompact(s)).Methods(http.MethodPost)
+	api.HandleFunc("/check", handleAPICheck(s)).Methods(http.MethodGet)
+	api.HandleFunc("/pages", handleAPIPageMap(s)).Methods(http.MethodGet)
+	api.HandleFunc("/pages/page", handleAPIPageDetails(s)).Methods(http.MethodGet)
+	api.NotFoundHandler = handleAPINotFound(s)
+}
+
+func (s *Server) respondJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		s.logger.Log(err.Error())
+	}
+}
+
+func (s *Server) respondErrorJSON(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	s.respondJSON(w, r, statusCode, map[string]any{
+		"error": map[string]any{
+			"status":  statusCode,
+			"message": err.Error(),
+		},
+	})
+}
+
+// JSON representation of a row.
+type apiRow struct {
+	Bucket kvstore.ListPath `json:"bucket,omitempty"`
+	Key    string           `json:"key"`
+	Value  string           `json:"value"`
+}
+
+// Key and value encodings used for a given API request.
+type apiEncodings struct {
+	Key   kvstore.Encoding
+	Value kvstore.Encoding
+}
+
+func parseAPIEncodings(r *http.Request) (*apiEncodings, error) {
+	var err error
+	out := &apiEncodings{}
+	out.Key, err = kvstore.ParseEncoding(r.URL.Query().Get("key_encoding"))
+	if err != nil {
+		return nil, err
+	}
+	out.Value, err = kvstore.ParseEncoding(r.URL.Query().Get("value_encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (enc *apiEncodings) encodeRow(list kvstore.ListPath, row *kvstore.Row) (*apiRow, error) {
+	var err error
+	out := &apiRow{Bucket: list}
+	out.Key, err = enc.Key.Encode(row.Key)
+	if err != nil {
+		return nil, err
+	}
+	out.Value, err = enc.Value.Encode(row.Value)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Encodes an optional key (used for cursors), nil keys are returned as JSON null.
+func (enc *apiEncodings) encodeKey(key kvstore.RowKey) (*string, error) {
+	if key == nil {
+		return nil, nil
+	}
+	out, err := enc.Key.Encode(key)
+	return &out, err
+}
+
+// Returns the bucket path set in the "bucket" URL query parameter.
+func parseAPIBucket(r *http.Request) (kvstore.ListPath, error) {
+	return kvstore.ParseListPath(r.URL.Query().Get("bucket"))
+}
+
+func handleAPINotFound(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respondErrorJSON(w, r, http.StatusNotFound, fmt.Errorf("%q not found", r.URL))
+	}
+}
+
+func handleAPIGetDBInfo(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		estimate, err := parseEstimateParam(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.disableWriteDeadline(w)
+		status, err := s.dbInfoCache.load(r.Context(), s.db, estimate, 0)
+		if err == nil {
+			err = status.Err
+		}
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+			return
+		} else if status.Info == nil {
+			s.respondErrorJSON(w, r, http.StatusServiceUnavailable, errors.New("stats are being recomputed, try again"))
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, status.Info)
+	}
+}
+
+func handleAPIListBuckets(s *Server) http.HandlerFunc {
+	type bucket struct {
+		ID   string           `json:"id"`
+		Path kvstore.ListPath `json:"path"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		lists, err := readAllLists(s.db)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		out := []*bucket{}
+		for _, path := range lists {
+			out = append(out, &bucket{ID: path.String(), Path: path})
+		}
+		s.respondJSON(w, r, http.StatusOK, out)
+	}
+}
+
+func handleAPICreateBucket(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Path kvstore.ListPath `json:"path"`
+		}{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if len(body.Path) == 0 {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, errors.New("bucket path is required"))
+			return
+		}
+
+		err = s.db.CreateList(body.Path)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusCreated, map[string]any{"id": body.Path.String(), "path": body.Path})
+	}
+}
+
+func handleAPIDeleteBucket(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = s.db.DeleteList(path)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Renames the bucket (or copies it if copy is true) to the path in the request body.
+func handleAPICopyBucket(s *Server, copy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		body := struct {
+			NewPath kvstore.ListPath `json:"new_path"`
+		}{}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if len(body.NewPath) == 0 {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, errors.New("new bucket path is required"))
+			return
+		}
+
+		statusCode, err := s.copyList(path, body.NewPath, copy)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCode, err)
+			return
+		}
+		statusCode = http.StatusOK
+		if copy {
+			statusCode = http.StatusCreated
+		}
+		s.respondJSON(w, r, statusCode, map[string]any{"id": body.NewPath.String(), "path": body.NewPath})
+	}
+}
+
+func handleAPIGetRow(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := enc.Key.Decode(r.URL.Query().Get("key"))
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		row, err := s.db.ReadRow(path, key)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		out, err := enc.encodeRow(path, row)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, out)
+	}
+}
+
+// Creates the row or replaces its value if it already exists.
+func handleAPIPutRow(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		body := &apiRow{}
+		err = json.NewDecoder(r.Body).Decode(body)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		row := &kvstore.Row{}
+		row.Key, err = enc.Key.Decode(body.Key)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		row.Value, err = enc.Value.Decode(body.Value)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := s.db.PutRow(path, row)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		statusCode := http.StatusOK
+		if created {
+			statusCode = http.StatusCreated
+		}
+		out, err := enc.encodeRow(path, row)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.respondJSON(w, r, statusCode, out)
+	}
+}
+
+func handleAPIDeleteRow(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := enc.Key.Decode(r.URL.Query().Get("key"))
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = s.db.DeleteRow(path, key)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Renames the row and/or moves it to another bucket (or copies it if copy is true),
+// the new bucket and key are read from the request body and default to the current ones.
+func handleAPIMoveRow(s *Server, copy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := enc.Key.Decode(r.URL.Query().Get("key"))
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		body := struct {
+			Bucket kvstore.ListPath `json:"bucket"`
+			Key    *string          `json:"key"`
+		}{}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		newPath, newKey := body.Bucket, key
+		if len(newPath) == 0 {
+			newPath = path
+		}
+		if body.Key != nil {
+			newKey, err = enc.Key.Decode(*body.Key)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		statusCode, err := s.moveRow(path, key, newPath, newKey, copy)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCode, err)
+			return
+		}
+		row, err := s.db.ReadRow(newPath, newKey)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		out, err := enc.encodeRow(newPath, row)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.respondJSON(w, r, statusCode, out)
+	}
+}
+
+// Reads a page of rows using the same cursor-based navigation as the bucket page.
+func handleAPIReadRowPage(s *Server) http.HandlerFunc {
+	const defaultLimit, maxLimit = 20, 1000
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse inputs
+		urlQueryParams := r.URL.Query()
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		cursor := &kvstore.RowCursor{Limit: defaultLimit}
+		if limit := urlQueryParams.Get("limit"); limit != "" {
+			cursor.Limit, err = strconv.Atoi(limit)
+			if err != nil || cursor.Limit <= 0 || cursor.Limit > maxLimit {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxLimit))
+				return
+			}
+		}
+		if seek := urlQueryParams.Get("seek"); seek != "" {
+			cursor.Seek, err = enc.Key.Decode(seek)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if prefix := urlQueryParams.Get("prefix"); prefix != "" {
+			cursor.Prefix, err = enc.Key.Decode(prefix)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if reverse := urlQueryParams.Get("reverse"); reverse != "" {
+			cursor.Reverse, err = strconv.ParseBool(reverse)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if last := urlQueryParams.Get("last"); last != "" {
+			cursor.Last, err = strconv.ParseBool(last)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		// Read page
+		page, err := s.db.ReadRowCursor(path, cursor)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		out := struct {
+			Rows []*apiRow `json:"rows"`
+			Prev *string   `json:"prev"`
+			Next *string   `json:"next"`
+		}{Rows: []*apiRow{}}
+		for _, row := range page.Rows {
+			encoded, err := enc.encodeRow(nil, row)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+			out.Rows = append(out.Rows, encoded)
+		}
+		out.Prev, err = enc.encodeKey(page.Prev)
+		if err == nil {
+			out.Next, err = enc.encodeKey(page.Next)
+		}
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, out)
+	}
+}
+
+// Searches rows using the same inputs as the search page.
+func handleAPISearch(s *Server) http.HandlerFunc {
+	const numRowsPerPage = 10
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse inputs
+		req, err := parseSearchRequest(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		} else if req.FilterErr != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, req.FilterErr)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if len(req.Search.Lists) == 0 {
+			req.Search.Lists, err = readAllLists(s.db)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		// Search DB
+		result, err := s.search(r, req, numRowsPerPage)
+		if errors.Is(err, kvstore.ErrNotFound) || errors.Is(err, kvstore.ErrInvalidPageToken) {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		} else if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		type searchRow struct {
+			*apiRow
+			Match        string                  `json:"match,omitempty"`
+			KeyMatches   []kvstore.MatchRange    `json:"key_matches,omitempty"`   // byte offsets in the key
+			ValueMatches []kvstore.MatchRange    `json:"value_matches,omitempty"` // byte offsets in the value
+			Fields       map[string]any          `json:"fields,omitempty"`        // projected JSON fields, null if missing
+			Replace      *kvstore.ReplacePreview `json:"replace,omitempty"`       // value before and after the replacement
+		}
+		out := struct {
+			Rows          []*searchRow `json:"rows"`
+			NextPageToken string       `json:"next_page_token,omitempty"` // pass as "page_token" to get the next page
+			Truncated     bool         `json:"truncated"`                 // the search timed out before the page was full
+		}{Rows: []*searchRow{}, Truncated: result.Truncated}
+		if result.Next != nil {
+			out.NextPageToken = result.Next.Token()
+		}
+		for _, resultRow := range result.Rows {
+			encoded, err := enc.encodeRow(resultRow.List, resultRow.Row)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+			row := &searchRow{
+				apiRow:       encoded,
+				Match:        resultRow.Match,
+				KeyMatches:   resultRow.KeyMatches,
+				ValueMatches: resultRow.ValueMatches,
+				Replace:      resultRow.Replace,
+			}
+			if len(resultRow.Fields) > 0 {
+				row.Fields = map[string]any{}
+				for _, field := range resultRow.Fields {
+					row.Fields[field.Path.String()] = field.Value
+				}
+			}
+			out.Rows = append(out.Rows, row)
+		}
+		s.respondJSON(w, r, http.StatusOK, out)
+	}
+}
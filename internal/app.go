@@ -6,8 +6,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ejuju/boltdb-webgui/pkg/boltutil"
 	"github.com/ejuju/boltdb-webgui/pkg/httputils"
@@ -16,21 +17,35 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// Config holds the server settings (set from command line arguments).
+type Config struct {
+	DBPath        string
+	ReadOnly      bool          // open the DB file in read-only mode
+	SearchTimeout time.Duration // partial results are returned after this delay (no limit if <= 0)
+	SearchWorkers int           // number of buckets searched concurrently
+}
+
 type Server struct {
-	db     kvstore.DB
-	logger logs.Logger
+	db            kvstore.DB
+	logger        logs.Logger
+	dbInfoCache   *dbInfoCache
+	searchTimeout time.Duration
+	searchWorkers int
 }
 
-func NewServer(fpath string) *Server {
+func NewServer(config *Config) *Server {
 	// Init logger
 	logger := logs.NewTextLogger(os.Stderr)
 
 	// Open DB file
-	db := boltutil.NewKeyValueDB(fpath)
+	db := boltutil.NewKeyValueDB(config.DBPath, config.ReadOnly)
 
 	return &Server{
-		db:     db,
-		logger: logger,
+		db:            db,
+		logger:        logger,
+		dbInfoCache:   newDBInfoCache(),
+		searchTimeout: config.SearchTimeout,
+		searchWorkers: config.SearchWorkers,
 	}
 }
 
@@ -46,16 +61,35 @@ func (s *Server) NewHTTPHandler() http.Handler {
 	router.HandleFunc("/db/new-bucket", serveDBNewBucketPage(s)).Methods(http.MethodGet)
 	router.HandleFunc("/db/new-bucket", handleDBNewBucketForm(s)).Methods(http.MethodPost)
 	router.HandleFunc("/db/search", serveDBSearchPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/search/bulk", handleDBSearchBulkForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/export", serveDBExport(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/import", serveDBImportPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/import", handleDBImportForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/backup", serveDBBackup(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/compact", serveDBCompactPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/compact", handleDBCompactForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/check", serveDBCheckPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/pages", servePageMapPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/pages/page", servePageDetailsPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/bucket", serveDBBucketPage(s)).Methods(http.MethodGet)
 	router.HandleFunc("/db/bucket/new-row", serveDBBucketNewRowPage(s)).Methods(http.MethodGet)
 	router.HandleFunc("/db/bucket/new-row", handleDBBucketNewRowForm(s)).Methods(http.MethodPost)
 	router.HandleFunc("/db/bucket/edit-row", serveDBBucketEditRowPage(s)).Methods(http.MethodGet)
 	router.HandleFunc("/db/bucket/edit-row", handleDBBucketEditRowForm(s)).Methods(http.MethodPost)
 	router.HandleFunc("/db/bucket/delete", handleDBBucketDeleteForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/bucket/delete-rows", serveDBBucketDeleteRowsPage(s)).Methods(http.MethodGet)
+	router.HandleFunc("/db/bucket/delete-rows", handleDBBucketDeleteRowsForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/bucket/rename", handleDBBucketCopyForm(s, false)).Methods(http.MethodPost)
+	router.HandleFunc("/db/bucket/copy", handleDBBucketCopyForm(s, true)).Methods(http.MethodPost)
 	router.HandleFunc("/db/bucket/delete-row", handleDBBucketDeleteRowForm(s)).Methods(http.MethodPost)
+	router.HandleFunc("/db/bucket/move-row", handleDBBucketMoveRowForm(s, false)).Methods(http.MethodPost)
+	router.HandleFunc("/db/bucket/copy-row", handleDBBucketMoveRowForm(s, true)).Methods(http.MethodPost)
 	router.NotFoundHandler = handleNotFound(s)
+	s.registerAPIRoutes(router)
 
 	// Register global middleware
 	var routerWithMW http.Handler = router
+	routerWithMW = s.invalidateDBInfoMiddleware(routerWithMW)
 	routerWithMW = httputils.AccessLoggingMiddleware(s.logger)(routerWithMW)
 	routerWithMW = httputils.PanicRecoveryMiddleware(s.logger, onPanicFunc(s))(routerWithMW)
 
@@ -64,6 +98,10 @@ func (s *Server) NewHTTPHandler() http.Handler {
 
 func onPanicFunc(s *Server) httputils.PanicHandler {
 	return func(w http.ResponseWriter, r *http.Request, err any) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, fmt.Errorf("%v", err))
+			return
+		}
 		s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, fmt.Errorf("%v", err))
 	}
 }
@@ -74,6 +112,22 @@ func handleNotFound(s *Server) http.HandlerFunc {
 	}
 }
 
+// Returns the HTTP status code corresponding to an error returned by a DB write operation.
+func statusCodeFromDBError(err error) int {
+	switch {
+	case errors.Is(err, kvstore.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, kvstore.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, kvstore.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, kvstore.ErrBusy):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func serveHomePage(s *Server) http.HandlerFunc {
 	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "home.gohtml")
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -84,23 +138,153 @@ func serveHomePage(s *Server) http.HandlerFunc {
 func serveDBPage(s *Server) http.HandlerFunc {
 	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db.gohtml")
 	return func(w http.ResponseWriter, r *http.Request) {
-		info, err := kvstore.GetDBInfo(s.db)
+		estimate, err := parseEstimateParam(r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		status, err := s.dbInfoCache.load(r.Context(), s.db, estimate, dbInfoWaitTimeout)
 		if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
 			return
 		}
-		s.respondPageOK(w, r, tmpl, map[string]any{"Info": info})
+		if status.Info == nil && status.Err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, status.Err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{"Info": status.Info, "Status": status})
+	}
+}
+
+func serveDBBucketPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-bucket.gohtml")
+	const numRowsPerPage = 20
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse inputs
+		urlQueryParams := r.URL.Query()
+		path, err := kvstore.ParseListPath(urlQueryParams.Get("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		keyEncoding, err := kvstore.ParseEncoding(urlQueryParams.Get("key_encoding"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		cursor := &kvstore.RowCursor{
+			Last:  urlQueryParams.Get("last") == "true",
+			Limit: numRowsPerPage,
+		}
+		if prefix := urlQueryParams.Get("prefix"); prefix != "" {
+			cursor.Prefix, err = keyEncoding.Decode(prefix)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if rawCursor := urlQueryParams.Get("cursor"); rawCursor != "" {
+			// Cursor is set by pagination links, it takes precedence over the seek input
+			cursor.Seek, err = kvstore.ParseRowKeyParam(rawCursor)
+		} else if seek := urlQueryParams.Get("seek"); seek != "" {
+			cursor.Seek, err = keyEncoding.Decode(seek)
+		}
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if reverse := urlQueryParams.Get("reverse"); reverse != "" {
+			cursor.Reverse, err = strconv.ParseBool(reverse)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		// Read page and nested buckets
+		page, err := s.db.ReadRowCursor(path, cursor)
+		if errors.Is(err, kvstore.ErrNotFound) {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		children := []kvstore.ListPath{}
+		err = s.db.ReadEachList(func(p kvstore.ListPath) error {
+			if len(p) == len(path)+1 && p[:len(path)].String() == path.String() {
+				children = append(children, p)
+			}
+			return nil
+		})
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Build navigation links, keeping the current prefix and ordering
+		pageURL := func(seek kvstore.RowKey, last bool) string {
+			params := url.Values{"id": {path.String()}}
+			if prefix := urlQueryParams.Get("prefix"); prefix != "" {
+				params.Set("prefix", prefix)
+				params.Set("key_encoding", string(keyEncoding))
+			}
+			if cursor.Reverse {
+				params.Set("reverse", "true")
+			}
+			if seek != nil {
+				params.Set("cursor", seek.Param())
+			}
+			if last {
+				params.Set("last", "true")
+			}
+			return "/db/bucket?" + params.Encode()
+		}
+		tmplData := map[string]any{
+			"Breadcrumbs": newListBreadcrumbs(path).WithoutLastLink(),
+			"Bucket":      path,
+			"Children":    children,
+			"Cursor":      cursor,
+			"Seek":        urlQueryParams.Get("seek"),
+			"Prefix":      urlQueryParams.Get("prefix"),
+			"KeyEncoding": keyEncoding,
+			"Encodings":   kvstore.Encodings,
+			"Page":        page,
+			"FirstURL":    pageURL(nil, false),
+			"LastURL":     pageURL(nil, true),
+		}
+		if page.Prev != nil {
+			tmplData["PrevURL"] = pageURL(page.Prev, false)
+		}
+		if page.Next != nil {
+			tmplData["NextURL"] = pageURL(page.Next, false)
+		}
+		s.respondPageOK(w, r, tmpl, tmplData)
 	}
 }
 
 func serveDBNewBucketPage(s *Server) http.HandlerFunc {
 	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-new-bucket.gohtml")
 	return func(w http.ResponseWriter, r *http.Request) {
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+
+		// Get optional parent bucket (new bucket is created at the top-level otherwise)
+		var parent kvstore.ListPath
+		if rawParent := r.URL.Query().Get("parent"); rawParent != "" {
+			var err error
+			parent, err = kvstore.ParseListPath(rawParent)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
 		s.respondPageOK(w, r, tmpl, map[string]any{
-			"Breadcrumbs": Breadcrumbs{
-				{Name: "DB buckets", Path: "/db"},
-				{Name: "Add new bucket"},
-			},
+			"Breadcrumbs": append(newListBreadcrumbs(parent), Breadcrumb{Name: "Add new bucket"}),
+			"Parent":      parent,
 		})
 	}
 }
@@ -112,19 +296,66 @@ func handleDBBucketDeleteForm(s *Server) http.HandlerFunc {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
 			return
 		}
-		id := r.FormValue("id")
+		path, err := kvstore.ParseListPath(r.FormValue("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		err = s.db.DeleteList(id)
-		if errors.Is(err, kvstore.ErrNotFound) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		err = s.db.DeleteList(path)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
 		} else {
 			http.Redirect(w, r, "/db", http.StatusSeeOther)
 		}
 	}
 }
 
+// Renames the bucket "id" to "new_id" (both encoded paths), or copies it if copy is true.
+func handleDBBucketCopyForm(s *Server, copy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		path, err := kvstore.ParseListPath(r.FormValue("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		newPath, err := kvstore.ParseListPath(r.FormValue("new_id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		statusCode, err := s.copyList(path, newPath, copy)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+		} else {
+			http.Redirect(w, r, "/db/bucket?id="+url.QueryEscape(newPath.String()), http.StatusSeeOther)
+		}
+	}
+}
+
+// Copies (or renames) a list and returns the status code corresponding to the error if any.
+func (s *Server) copyList(path, newPath kvstore.ListPath, copy bool) (int, error) {
+	if path.Contains(newPath) {
+		return http.StatusBadRequest, fmt.Errorf("can't copy or move bucket %q into itself", path.Display())
+	}
+	var err error
+	if copy {
+		err = s.db.CopyList(path, newPath)
+	} else {
+		err = s.db.RenameList(path, newPath)
+	}
+	if err != nil {
+		return statusCodeFromDBError(err), err
+	}
+	return http.StatusOK, nil
+}
+
 func handleDBBucketDeleteRowForm(s *Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
@@ -133,12 +364,21 @@ func handleDBBucketDeleteRowForm(s *Server) http.HandlerFunc {
 			return
 		}
 		id := r.FormValue("id")
-		err = s.db.DeleteRow(id, r.FormValue("key"))
+		path, err := kvstore.ParseListPath(id)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := kvstore.ParseRowKeyParam(r.FormValue("key"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		if errors.Is(err, kvstore.ErrNotFound) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		err = s.db.DeleteRow(path, key)
+
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
 		} else {
 			http.Redirect(w, r, "/db/bucket?id="+url.QueryEscape(id), http.StatusSeeOther)
 		}
@@ -148,16 +388,30 @@ func handleDBBucketDeleteRowForm(s *Server) http.HandlerFunc {
 func serveDBBucketNewRowPage(s *Server) http.HandlerFunc {
 	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-bucket-new-row.gohtml")
 	return func(w http.ResponseWriter, r *http.Request) {
-		bucketName := r.URL.Query().Get("id")
-		numRows, err := s.db.NumRows(bucketName)
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+
+		path, err := kvstore.ParseListPath(r.URL.Query().Get("id"))
 		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		numRows, err := s.db.NumRows(path)
+		if errors.Is(err, kvstore.ErrNotFound) {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
 		s.respondPageOK(w, r, tmpl, map[string]any{
-			"BucketID": bucketName,
-			"AutoKey":  numRows + 1,
+			"Breadcrumbs": append(newListBreadcrumbs(path), Breadcrumb{Name: "Add new row"}),
+			"Bucket":      path,
+			"AutoKey":     numRows + 1,
+			"Encodings":   kvstore.Encodings,
 		})
 	}
 }
@@ -170,15 +424,26 @@ func handleDBBucketNewRowForm(s *Server) http.HandlerFunc {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
 			return
 		}
-		key := r.FormValue("key")
-		value := r.FormValue("value")
 		bucketID := r.FormValue("id")
+		path, err := kvstore.ParseListPath(bucketID)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := decodeFormValue(r, "key")
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		value, err := decodeFormValue(r, "value")
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		err = s.db.CreateRow(bucketID, &kvstore.Row{Key: kvstore.RowKey(key), Value: kvstore.RowValue(value)})
-		if errors.Is(err, kvstore.ErrNotFound) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		err = s.db.CreateRow(path, &kvstore.Row{Key: key, Value: value})
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
 		} else {
 			http.Redirect(w, r, "/db/bucket?id="+url.QueryEscape(bucketID), http.StatusSeeOther)
 		}
@@ -187,22 +452,33 @@ func handleDBBucketNewRowForm(s *Server) http.HandlerFunc {
 
 func handleDBNewBucketForm(s *Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse form and get bucket name
+		// Parse form and get bucket name (and parent bucket if any)
 		err := r.ParseForm()
 		if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
 			return
 		}
 		name := r.FormValue("name")
+		if name == "" {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, errors.New("bucket name is required"))
+			return
+		}
+		path := kvstore.ListPath{name}
+		if parent := r.FormValue("parent"); parent != "" {
+			parentPath, err := kvstore.ParseListPath(parent)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			}
+			path = parentPath.Child(name)
+		}
 
 		// Create bucket in DB and redirect to newly created bucket on success
-		err = s.db.CreateList(name)
-		if errors.Is(err, kvstore.ErrAlreadyExists) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		err = s.db.CreateList(path)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
 		} else {
-			http.Redirect(w, r, "/db/search?list="+url.QueryEscape(name), http.StatusSeeOther)
+			http.Redirect(w, r, "/db/bucket?id="+url.QueryEscape(path.String()), http.StatusSeeOther)
 		}
 	}
 }
@@ -211,26 +487,63 @@ func serveDBBucketEditRowPage(s *Server) http.HandlerFunc {
 	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-bucket-edit-row.gohtml")
 	return func(w http.ResponseWriter, r *http.Request) {
 		urlQueryParams := r.URL.Query()
-		id := urlQueryParams.Get("id")
-		key := urlQueryParams.Get("key")
+		path, err := kvstore.ParseListPath(urlQueryParams.Get("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := kvstore.ParseRowKeyParam(urlQueryParams.Get("key"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		row, err := s.db.ReadRow(id, key)
+		row, err := s.db.ReadRow(path, key)
 		if errors.Is(err, kvstore.ErrNotFound) {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
+			return
 		} else if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
-		} else {
-			s.respondPageOK(w, r, tmpl, map[string]any{
-				"Breadcrumbs": Breadcrumbs{
+			return
+		}
 
-					{Name: "DB buckets", Path: "/db"},
-					{Name: id, Path: "/db/search?list=" + url.QueryEscape(id)},
-					{Name: key},
-				},
-				"BucketID": id,
-				"Row":      row,
-			})
+		// Show value as text by default, or as hex if it contains binary data
+		valueEncoding := kvstore.EncodingText
+		if !row.Value.IsText() {
+			valueEncoding = kvstore.EncodingHex
+		}
+		if rawEncoding := urlQueryParams.Get("encoding"); rawEncoding != "" {
+			valueEncoding, err = kvstore.ParseEncoding(rawEncoding)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		value, err := valueEncoding.Encode(row.Value)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		keyEncoding := kvstore.EncodingText
+		if !row.Key.IsText() {
+			keyEncoding = kvstore.EncodingHex
+		}
+		encodedKey, err := keyEncoding.Encode(row.Key)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
 		}
+
+		s.respondPageOK(w, r, tmpl, map[string]any{
+			"Breadcrumbs":   append(newListBreadcrumbs(path), Breadcrumb{Name: row.Key.Display()}),
+			"Bucket":        path,
+			"Row":           row,
+			"Value":         value,
+			"ValueEncoding": valueEncoding,
+			"Key":           encodedKey,
+			"KeyEncoding":   keyEncoding,
+			"Encodings":     kvstore.Encodings,
+		})
 	}
 }
 
@@ -242,107 +555,197 @@ func handleDBBucketEditRowForm(s *Server) http.HandlerFunc {
 			return
 		}
 		id := r.FormValue("id")
-		key := r.FormValue("key")
-		value := r.FormValue("value")
+		path, err := kvstore.ParseListPath(id)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		key, err := kvstore.ParseRowKeyParam(r.FormValue("key"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		value, err := decodeFormValue(r, "value")
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		err = s.db.UpdateRow(id, key, value)
-		if errors.Is(err, kvstore.ErrNotFound) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusNotFound, err)
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		err = s.db.UpdateRow(path, key, value)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
 		} else {
 			http.Redirect(w, r, "/db/bucket?id="+url.QueryEscape(id), http.StatusSeeOther)
 		}
 	}
 }
 
-func serveDBSearchPage(s *Server) http.HandlerFunc {
-	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-search.gohtml")
-	const numRowsPerPage = 10
+// Renames the row and/or moves it to the bucket "new_id" (or copies it if copy is true),
+// the new key is decoded from "new_key" with "new_key_encoding".
+func handleDBBucketMoveRowForm(s *Server, copy bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse inputs
 		err := r.ParseForm()
 		if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
 			return
 		}
-		selectedLists := r.Form["list"]
-		query := r.FormValue("query")
-		exclude := r.FormValue("exclude")
-		if exclude == "" {
-			exclude = "false"
+		path, err := kvstore.ParseListPath(r.FormValue("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
 		}
-		excludeQueryMatches, err := strconv.ParseBool(exclude)
+		key, err := kvstore.ParseRowKeyParam(r.FormValue("key"))
 		if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
 			return
 		}
-		page := r.FormValue("page")
-		pageIndex := 0
-		if page != "" && page != "0" {
-			pageIndex, err = strconv.Atoi(page)
-			if err != nil {
-				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
-				return
-			}
+		newPath, err := kvstore.ParseListPath(r.FormValue("new_id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		newKey, err := decodeFormValue(r, "new_key")
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
 		}
 
-		// Compile regex from query if needed
-		var regex *regexp.Regexp
-		if query != "" {
-			regex, err = regexp.Compile(query)
-			if err != nil {
-				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
-				return
-			}
+		statusCode, err := s.moveRow(path, key, newPath, newKey, copy)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+		} else {
+			http.Redirect(w, r, "/db/bucket/edit-row?id="+url.QueryEscape(newPath.String())+"&key="+kvstore.RowKey(newKey).Param(), http.StatusSeeOther)
 		}
+	}
+}
 
-		// List all buckets, set selected lists default if needed and set search list for UI
-		lists := []string{}
-		err = s.db.ReadEachList(func(name string) error { lists = append(lists, name); return nil })
+// Moves (or copies) a row and returns the status code corresponding to the error if any
+// (409 Conflict if the new key already exists).
+func (s *Server) moveRow(path kvstore.ListPath, key kvstore.RowKey, newPath kvstore.ListPath, newKey kvstore.RowKey, copy bool) (int, error) {
+	if len(newKey) == 0 {
+		return http.StatusBadRequest, errors.New("new key is required")
+	}
+	var err error
+	if copy {
+		err = s.db.CopyRow(path, key, newPath, newKey)
+	} else {
+		err = s.db.MoveRow(path, key, newPath, newKey)
+	}
+	if err != nil {
+		return statusCodeFromDBError(err), err
+	}
+	if copy {
+		return http.StatusCreated, nil
+	}
+	return http.StatusOK, nil
+}
+
+func serveDBSearchPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-search.gohtml")
+	const numRowsPerPage = 10
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse inputs
+		req, err := parseSearchRequest(r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// List all buckets (including nested ones), set selected lists default if needed and set search list for UI
+		lists, err := readAllLists(s.db)
 		if err != nil {
 			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
 			return
 		}
-		if len(selectedLists) == 0 {
-			selectedLists = lists
+		if len(req.Search.Lists) == 0 {
+			req.Search.Lists = lists
 		}
-		searchLists := map[string]bool{}
-		for _, name := range lists {
-			searchLists[name] = false
-			for _, selectedName := range selectedLists {
-				if selectedName == name {
-					searchLists[name] = true
+		selectedLists := req.Search.Lists
+		searchLists := []*searchListOption{}
+		for _, path := range lists {
+			option := &searchListOption{Path: path}
+			for _, selectedPath := range selectedLists {
+				if selectedPath.String() == path.String() {
+					option.Checked = true
 				}
 			}
+			searchLists = append(searchLists, option)
 		}
 
-		// Search DB
-		result, err := kvstore.Search(s.db, selectedLists, regex, excludeQueryMatches, pageIndex, numRowsPerPage)
-		if errors.Is(err, kvstore.ErrNotFound) {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
-			return
-		} else if err != nil {
-			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
-			return
+		// Search DB (unless the filter is invalid, the error is then shown in the form)
+		statusCode := http.StatusOK
+		result := &kvstore.SearchResult{}
+		if req.FilterErr != nil {
+			statusCode = http.StatusBadRequest
+		} else {
+			result, err = s.search(r, req, numRowsPerPage)
+			if errors.Is(err, kvstore.ErrNotFound) || errors.Is(err, kvstore.ErrInvalidPageToken) {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+				return
+			} else if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+				return
+			}
 		}
 
 		// OK
 		tmplData := map[string]any{
-			"Result":        result,
-			"Lists":         searchLists,
-			"SelectedLists": selectedLists,
-			"Query":         query,
-			"Exclude":       excludeQueryMatches,
-			"PageIndex":     pageIndex,
-			"Pages":         make([]struct{}, 1+result.TotalResults/numRowsPerPage),
+			"Result":           result,
+			"Lists":            searchLists,
+			"SelectedLists":    selectedLists,
+			"Search":           req,
+			"Query":            req.Query,
+			"Exclude":          req.Search.Exclude,
+			"Targets":          kvstore.SearchTargets,
+			"SortFields":       kvstore.SearchSortFields,
+			"Encodings":        kvstore.Encodings,
+			"PageNumber":       len(req.PrevTokens) + 1,
+			"BulkActions":      kvstore.BulkActions,
+			"ConflictPolicies": kvstore.ConflictPolicies,
 		}
-		if len(selectedLists) == 1 {
-			tmplData["Breadcrumbs"] = Breadcrumbs{
-				{Name: "DB buckets", Path: "/db"},
-				{Name: selectedLists[0]},
+
+		// Build navigation links, previous page tokens are kept in the URL to go back
+		pageURL := func(token string, prevTokens []string) string {
+			params := r.URL.Query()
+			params.Del("page_token")
+			params.Del("prev_page_token")
+			if token != "" {
+				params.Set("page_token", token)
 			}
+			params["prev_page_token"] = prevTokens
+			return "/db/search?" + params.Encode()
 		}
-		s.respondPageOK(w, r, tmpl, tmplData)
+		searchParams := r.URL.Query()
+		for _, name := range []string{"page_token", "prev_page_token", "snippets"} {
+			searchParams.Del(name)
+		}
+		tmplData["SearchParams"] = searchParams.Encode() // for bulk operations
+		if len(req.PrevTokens) > 0 {
+			last := len(req.PrevTokens) - 1
+			tmplData["FirstURL"] = pageURL("", nil)
+			tmplData["PrevURL"] = pageURL(req.PrevTokens[last], req.PrevTokens[:last])
+		}
+		if result.Next != nil {
+			prevTokens := append(append([]string{}, req.PrevTokens...), req.PageToken)
+			tmplData["NextURL"] = pageURL(result.Next.Token(), prevTokens)
+		}
+		if req.FilterErr != nil {
+			// Highlight the filter from the position of the error
+			pos := req.FilterErr.Pos
+			if pos > len(req.Filter) {
+				pos = len(req.Filter)
+			}
+			tmplData["FilterErrBefore"], tmplData["FilterErrAfter"] = req.Filter[:pos], req.Filter[pos:]
+		}
+		if len(selectedLists) == 1 {
+			tmplData["Breadcrumbs"] = newListBreadcrumbs(selectedLists[0]).WithoutLastLink()
+		}
+		s.respondHTMLTmpl(w, r, statusCode, tmpl, tmplLayoutKey, tmplData)
 	}
 }
+
+// Checkbox for a bucket in the search form.
+type searchListOption struct {
+	Path    kvstore.ListPath
+	Checked bool
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Removes the server write timeout for the current request, used for downloads that can take a while.
+// The error is only logged since the download may still complete within the timeout.
+func (s *Server) disableWriteDeadline(w http.ResponseWriter) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.logger.Log(fmt.Sprintf("disable write deadline: %s", err))
+	}
+}
+
+// Removes the server read timeout for the current request, used for uploads that can take a while.
+func (s *Server) disableReadDeadline(w http.ResponseWriter) {
+	err := http.NewResponseController(w).SetReadDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.logger.Log(fmt.Sprintf("disable read deadline: %s", err))
+	}
+}
+
+// Streams a consistent snapshot of the DB file.
+// Errors that occur before anything was written are returned,
+// errors that occur during streaming are only logged (since the response status was already sent).
+func (s *Server) respondBackup(w http.ResponseWriter, r *http.Request) error {
+	s.disableWriteDeadline(w)
+	dbPath := s.db.DiskPath()
+	ext := filepath.Ext(dbPath)
+	fname := strings.TrimSuffix(filepath.Base(dbPath), ext) + "-" + time.Now().UTC().Format("20060102T150405Z") + ext
+	started := false
+	_, err := s.db.Backup(w, func(size int64) {
+		started = true
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fname}))
+	})
+	if err != nil && started {
+		s.logger.Log(fmt.Sprintf("backup: %s", err))
+		return nil
+	}
+	return err
+}
+
+func serveDBBackup(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.respondBackup(w, r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+		}
+	}
+}
+
+func handleAPIBackup(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.respondBackup(w, r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+		}
+	}
+}
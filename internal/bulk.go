@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+const bulkExport = "export" // bulk action that downloads the rows instead of changing them
+
+// Bulk operation inputs, shared by the search page and the API.
+type bulkRequest struct {
+	Search    *searchRequest
+	Action    string                 // kvstore.BulkAction or "export"
+	Op        *kvstore.BulkOperation // nil for exports
+	Export    *exportRequest         // for exports
+	Selection []string               // references of the selected rows ("<key param>.<list path>"), empty for all matches
+	Lists     []kvstore.ListPath     // lists to read
+	KeyRange  *kvstore.KeyRange
+	Match     kvstore.RowMatcher
+}
+
+// Parses bulk operation inputs, the rows are selected by the search inputs (see parseSearchForm),
+// or only by the "row" fields (repeatable) if any are set and "scope" is not "all".
+// Other inputs are read from the form fields "action" (delete, copy, move, replace or export),
+// "destination" and "on_conflict" (for copy and move) and "format" and "encoding" (for exports).
+func (s *Server) parseBulkRequest(searchForm, form url.Values) (*bulkRequest, error) {
+	var err error
+	out := &bulkRequest{Action: form.Get("action")}
+	out.Search, err = parseSearchForm(searchForm)
+	if err != nil {
+		return nil, err
+	} else if out.Search.FilterErr != nil {
+		return nil, out.Search.FilterErr
+	}
+
+	// Parse action
+	if out.Action == bulkExport {
+		out.Export, err = parseExportForm(form)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		out.Op = &kvstore.BulkOperation{}
+		out.Op.Action, err = kvstore.ParseBulkAction(out.Action)
+		if err != nil {
+			return nil, err
+		}
+		out.Op.OnConflict, err = kvstore.ParseConflictPolicy(form.Get("on_conflict"))
+		if err != nil {
+			return nil, err
+		}
+		if out.Op.Action == kvstore.BulkReplace {
+			if out.Op.Replace = out.Search.Search.Replace; out.Op.Replace == nil {
+				return nil, errors.New("replace requires a find and replace search")
+			}
+		} else if out.Op.Action != kvstore.BulkDelete {
+			if form.Get("destination") == "" {
+				return nil, errors.New("missing destination bucket")
+			}
+			out.Op.Target, err = kvstore.ParseListPath(form.Get("destination"))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Select rows
+	if form.Get("scope") != "all" {
+		out.Selection = form["row"]
+	}
+	if len(out.Selection) == 0 && form.Get("scope") == "selected" {
+		return nil, errors.New("no rows selected")
+	}
+	if len(out.Selection) > 0 {
+		selection := kvstore.ListRowSet{}
+		seen := map[string]bool{}
+		for _, ref := range out.Selection {
+			rawKey, rawList, ok := strings.Cut(ref, ".")
+			if !ok {
+				return nil, fmt.Errorf("invalid row reference %q", ref)
+			}
+			key, err := kvstore.ParseRowKeyParam(rawKey)
+			if err != nil {
+				return nil, err
+			}
+			list, err := kvstore.ParseListPath(rawList)
+			if err != nil {
+				return nil, err
+			}
+			selection.Add(list, key)
+			if !seen[list.String()] {
+				seen[list.String()] = true
+				out.Lists = append(out.Lists, list)
+			}
+		}
+		out.KeyRange, out.Match = &kvstore.KeyRange{}, selection.Match
+	} else {
+		out.Lists, out.KeyRange, out.Match = out.Search.Search.Lists, &out.Search.Search.KeyRange, out.Search.Search.Match
+		if len(out.Lists) == 0 {
+			out.Lists, err = readAllLists(s.db)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if out.Export != nil {
+		out.Export.Lists, out.Export.KeyRange, out.Export.Match = out.Lists, out.KeyRange, out.Match
+	}
+	return out, nil
+}
+
+// Applies the bulk operation (or counts the affected rows if dry-run is true).
+func (s *Server) applyBulkRequest(req *bulkRequest, dryRun bool) (*kvstore.WriteReport, int, error) {
+	report, err := s.db.ApplyToRows(req.Lists, req.KeyRange, req.Match, req.Op, dryRun)
+	if err != nil {
+		statusCode := statusCodeFromDBError(err)
+		if statusCode == http.StatusInternalServerError {
+			statusCode = http.StatusBadRequest // most likely an invalid destination
+		}
+		return nil, statusCode, err
+	}
+	return report, http.StatusOK, nil
+}
+
+// Shows the number of affected rows and asks for confirmation, then applies the operation once confirmed.
+// The search inputs are sent in the "search" field (URL-encoded) so they can be repeated in the confirmation form.
+func handleDBSearchBulkForm(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-search-bulk.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		searchForm, err := url.ParseQuery(r.FormValue("search"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		req, err := s.parseBulkRequest(searchForm, r.Form)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if req.Export != nil {
+			statusCode, err := s.respondExport(w, r, req.Export)
+			if err != nil {
+				s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+			}
+			return
+		}
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+
+		confirmed := r.FormValue("confirm") == "true"
+		report, statusCode, err := s.applyBulkRequest(req, !confirmed)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{
+			"Action":     req.Op.Action,
+			"Target":     req.Op.Target,
+			"OnConflict": req.Op.OnConflict,
+			"Replace":    req.Op.Replace,
+			"Selection":  req.Selection,
+			"Search":     r.FormValue("search"),
+			"SearchURL":  "/db/search?" + r.FormValue("search"),
+			"Report":     report,
+			"Done":       confirmed,
+		})
+	}
+}
+
+// Applies a bulk operation to search results, using the same search inputs as the search page,
+// or streams the rows as a file for exports.
+func handleAPISearchBulk(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		req, err := s.parseBulkRequest(r.Form, r.Form)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if req.Export != nil {
+			statusCode, err := s.respondExport(w, r, req.Export)
+			if err != nil {
+				s.respondErrorJSON(w, r, statusCode, err)
+			}
+			return
+		}
+
+		dryRun := false
+		if rawDryRun := r.FormValue("dry_run"); rawDryRun != "" {
+			dryRun, err = strconv.ParseBool(rawDryRun)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		report, statusCode, err := s.applyBulkRequest(req, dryRun)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCode, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, report)
+	}
+}
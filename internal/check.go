@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+// Result of an integrity check, set once the issues channel is closed.
+type checkResult struct {
+	Report *kvstore.CheckReport
+	Err    error
+}
+
+// Issue found or progress reported during an integrity check, only one of the fields is set.
+type checkEvent struct {
+	Issue    *kvstore.CheckIssue
+	Progress *kvstore.CheckProgress
+}
+
+// Streams the check results: issues and progress lines are rendered as soon as they are reported
+// (the template ranges over the events channel and each write is flushed).
+func serveDBCheckPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-check.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		events := make(chan *checkEvent)
+		send := func(event *checkEvent) error {
+			select {
+			case events <- event:
+				return nil
+			case <-r.Context().Done(): // client is gone or the template failed to render
+				return r.Context().Err()
+			}
+		}
+		result := &checkResult{}
+		go func() {
+			defer close(events)
+			result.Report, result.Err = s.db.Check(
+				func(issue *kvstore.CheckIssue) error { return send(&checkEvent{Issue: issue}) },
+				func(progress *kvstore.CheckProgress) { _ = send(&checkEvent{Progress: progress}) },
+			)
+		}()
+		s.respondPageOK(&flushingResponseWriter{ResponseWriter: w}, r, tmpl, map[string]any{
+			"Events": events,
+			"Result": result,
+		})
+	}
+}
+
+func handleAPICheck(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		issues := []*kvstore.CheckIssue{}
+		report, err := s.db.Check(func(issue *kvstore.CheckIssue) error {
+			issues = append(issues, issue)
+			return nil
+		}, nil)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, map[string]any{
+			"ok":     report.OK(),
+			"report": report,
+			"issues": issues,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+func serveDBCompactPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-compact.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+		info, err := kvstore.GetDBInfoWithOptions(s.db, &kvstore.DBInfoOptions{WithoutLists: true})
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{"Info": info})
+	}
+}
+
+func handleDBCompactForm(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-compact.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		report, err := s.db.Compact()
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		info, err := kvstore.GetDBInfoWithOptions(s.db, &kvstore.DBInfoOptions{WithoutLists: true})
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{"Info": info, "Report": report})
+	}
+}
+
+func handleAPICompact(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		report, err := s.db.Compact()
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+// Export inputs, shared by the web UI and the API.
+type exportRequest struct {
+	Lists    []kvstore.ListPath // empty to export the whole DB
+	Format   kvstore.ExportFormat
+	Encoding kvstore.Encoding
+	KeyRange *kvstore.KeyRange  // for exports of search results
+	Match    kvstore.RowMatcher // only export rows accepted by this function (all rows if nil)
+}
+
+// Parses export inputs from the URL query parameters "list" (repeatable), "format" and "encoding".
+func parseExportRequest(r *http.Request) (*exportRequest, error) {
+	return parseExportForm(r.URL.Query())
+}
+
+// Same as parseExportRequest, for export inputs sent in a form.
+func parseExportForm(urlQueryParams url.Values) (*exportRequest, error) {
+	var err error
+	out := &exportRequest{}
+	for _, rawPath := range urlQueryParams["list"] {
+		path, err := kvstore.ParseListPath(rawPath)
+		if err != nil {
+			return nil, err
+		}
+		out.Lists = append(out.Lists, path)
+	}
+	out.Format, err = kvstore.ParseExportFormat(urlQueryParams.Get("format"))
+	if err != nil {
+		return nil, err
+	}
+	out.Encoding, err = kvstore.ParseEncoding(urlQueryParams.Get("encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if out.Encoding == kvstore.EncodingInt {
+		return nil, errors.New("int encoding can't be used for exports")
+	}
+	return out, nil
+}
+
+// Returns the file name (without extension) of an export.
+func (req *exportRequest) fileName(dbPath string) string {
+	name := strings.TrimSuffix(filepath.Base(dbPath), filepath.Ext(dbPath))
+	if len(req.Lists) == 1 {
+		name += "-" + strings.Join(req.Lists[0], "-")
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// Streams the export file.
+// Errors that occur before anything was written are returned with their status code,
+// errors that occur during streaming are only logged (since the response status was already sent).
+func (s *Server) respondExport(w http.ResponseWriter, r *http.Request, req *exportRequest) (int, error) {
+	// Export whole DB by default
+	withList := len(req.Lists) != 1
+	lists := req.Lists
+	if len(lists) == 0 {
+		var err error
+		lists, err = readAllLists(s.db)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	for _, list := range lists {
+		exists, err := s.db.ListExists(list) // before writing headers
+		if err != nil {
+			return http.StatusInternalServerError, err
+		} else if !exists {
+			return http.StatusNotFound, kvstore.NewErrNotFound(list.String())
+		}
+	}
+
+	// Stream rows
+	s.disableWriteDeadline(w)
+	rw, err := kvstore.NewRowWriter(w, req.Format, req.Encoding, withList)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	w.Header().Set("Content-Type", req.Format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": req.fileName(s.db.DiskPath()) + "." + string(req.Format),
+	}))
+	if req.Match != nil {
+		err = kvstore.ExportMatches(s.db, rw, lists, req.KeyRange, req.Match)
+	} else {
+		err = kvstore.Export(s.db, rw, lists)
+	}
+	if err != nil {
+		s.logger.Log(fmt.Sprintf("export: %s", err))
+	}
+	return http.StatusOK, nil
+}
+
+func serveDBExport(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseExportRequest(r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		statusCode, err := s.respondExport(w, r, req)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+		}
+	}
+}
+
+func handleAPIExport(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseExportRequest(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		statusCode, err := s.respondExport(w, r, req)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCode, err)
+		}
+	}
+}
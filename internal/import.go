@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+const maxImportMemory = 32 << 20 // larger uploads are stored in temporary files
+
+// Import inputs, shared by the web UI and the API.
+type importRequest struct {
+	Format   kvstore.ExportFormat
+	Encoding kvstore.Encoding
+	Options  *kvstore.ImportOptions
+}
+
+// Parses import inputs from the form fields "format", "encoding", "list" (target for rows without bucket),
+// "on_conflict", "batch_size" and "dry_run".
+func parseImportRequest(r *http.Request) (*importRequest, error) {
+	var err error
+	out := &importRequest{Options: &kvstore.ImportOptions{}}
+	out.Format, err = kvstore.ParseExportFormat(r.FormValue("format"))
+	if err != nil {
+		return nil, err
+	}
+	out.Encoding, err = kvstore.ParseEncoding(r.FormValue("encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if out.Encoding == kvstore.EncodingInt {
+		return nil, errors.New("int encoding can't be used for imports")
+	}
+	if rawList := r.FormValue("list"); rawList != "" {
+		out.Options.DefaultList, err = kvstore.ParseListPath(rawList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out.Options.OnConflict, err = kvstore.ParseConflictPolicy(r.FormValue("on_conflict"))
+	if err != nil {
+		return nil, err
+	}
+	if rawBatchSize := r.FormValue("batch_size"); rawBatchSize != "" {
+		out.Options.BatchSize, err = strconv.Atoi(rawBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch size: %w", err)
+		}
+	}
+	if rawDryRun := r.FormValue("dry_run"); rawDryRun != "" {
+		out.Options.DryRun, err = strconv.ParseBool(rawDryRun)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Imports the uploaded file (multipart field "file").
+// The server timeouts are removed since large files can take a while to upload and import.
+// If the import fails, the report of the batches written before the error is returned along with it.
+func (s *Server) importUploadedFile(w http.ResponseWriter, r *http.Request) (*importRequest, *kvstore.WriteReport, int, error) {
+	s.disableReadDeadline(w)
+	s.disableWriteDeadline(w)
+	err := r.ParseMultipartForm(maxImportMemory)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	req, err := parseImportRequest(r)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return req, nil, http.StatusBadRequest, err
+	}
+	defer f.Close()
+	rr, err := kvstore.NewRowReader(f, req.Format, req.Encoding)
+	if err != nil {
+		return req, nil, http.StatusBadRequest, err
+	}
+	report, err := kvstore.Import(s.db, rr, req.Options)
+	if err != nil {
+		statusCode := statusCodeFromDBError(err)
+		if statusCode == http.StatusInternalServerError {
+			statusCode = http.StatusBadRequest // most likely a malformed file
+		}
+		if req.Options.DryRun {
+			report = nil // nothing was written
+		}
+		return req, report, statusCode, err
+	}
+	return req, report, http.StatusOK, nil
+}
+
+func serveDBImportPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-import.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{
+			"List":             r.URL.Query().Get("list"),
+			"ConflictPolicies": kvstore.ConflictPolicies,
+			"OnConflict":       kvstore.ConflictFail,
+		})
+	}
+}
+
+func handleDBImportForm(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-import.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, report, statusCode, err := s.importUploadedFile(w, r)
+		if err != nil && req == nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCode, err)
+			return
+		}
+
+		// Show the form again along with the report (or error) so the import can be re-run
+		tmplData := map[string]any{
+			"List":             r.FormValue("list"),
+			"ConflictPolicies": kvstore.ConflictPolicies,
+			"OnConflict":       req.Options.OnConflict,
+			"Format":           req.Format,
+			"Encoding":         req.Encoding,
+			"BatchSize":        r.FormValue("batch_size"),
+			"DryRun":           req.Options.DryRun,
+			"Report":           report,
+			"Error":            err,
+		}
+		s.respondHTMLTmpl(w, r, statusCode, tmpl, tmplLayoutKey, tmplData)
+	}
+}
+
+func handleAPIImport(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, report, statusCode, err := s.importUploadedFile(w, r)
+		if err != nil && report != nil {
+			// Tell the client which rows were already written
+			s.respondJSON(w, r, statusCode, map[string]any{
+				"error":  map[string]any{"status": statusCode, "message": err.Error()},
+				"report": report,
+			})
+			return
+		} else if err != nil {
+			s.respondErrorJSON(w, r, statusCode, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+const defaultPageMapLimit = 1024
+const maxPageMapLimit = 16384
+
+// Parses the "offset" and "limit" URL query parameters of page map requests.
+func parsePageMapRange(r *http.Request) (offset, limit int, err error) {
+	limit = defaultPageMapLimit
+	if rawOffset := r.URL.Query().Get("offset"); rawOffset != "" {
+		offset, err = strconv.Atoi(rawOffset)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", rawOffset)
+		}
+	}
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 || limit > maxPageMapLimit {
+			return 0, 0, fmt.Errorf("invalid limit %q (max %d)", rawLimit, maxPageMapLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// Parses the "id" URL query parameter of page requests.
+func parsePageID(r *http.Request) (uint64, error) {
+	rawID := r.URL.Query().Get("id")
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page ID %q", rawID)
+	}
+	return id, nil
+}
+
+// A cell of the page map grid, overflow pages are shown as continuations of their page.
+type pageMapCell struct {
+	ID           uint64
+	Page         *kvstore.PageInfo
+	Continuation bool
+}
+
+func servePageMapPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-pages.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w) // the first request of a transaction reads every branch and leaf page
+		offset, limit, err := parsePageMapRange(r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		pageMap, err := s.db.ReadPageMap(offset, limit)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Build grid cells and usage summary
+		cells := []*pageMapCell{}
+		numPagesByType := map[string]int{}
+		for _, page := range pageMap.Pages {
+			for i := 0; i <= page.Overflow; i++ {
+				if id := page.ID + uint64(i); id >= uint64(offset) && id < uint64(offset+limit) {
+					cells = append(cells, &pageMapCell{ID: id, Page: page, Continuation: i > 0})
+					numPagesByType[page.Type]++
+				}
+			}
+		}
+		pageURL := func(offset int) string {
+			return "/db/pages?" + url.Values{"offset": {strconv.Itoa(offset)}, "limit": {strconv.Itoa(limit)}}.Encode()
+		}
+		tmplData := map[string]any{
+			"PageMap":        pageMap,
+			"Cells":          cells,
+			"NumPagesByType": numPagesByType,
+			"Offset":         offset,
+			"End":            offset + len(cells),
+		}
+		if offset > 0 {
+			prevOffset := offset - limit
+			if prevOffset < 0 {
+				prevOffset = 0
+			}
+			tmplData["PrevURL"] = pageURL(prevOffset)
+		}
+		if offset+limit < pageMap.NumPages {
+			tmplData["NextURL"] = pageURL(offset + limit)
+		}
+		s.respondPageOK(w, r, tmpl, tmplData)
+	}
+}
+
+func servePageDetailsPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-page.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		id, err := parsePageID(r)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		content, err := s.db.ReadPage(id)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{"Content": content})
+	}
+}
+
+func handleAPIPageMap(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		offset, limit, err := parsePageMapRange(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		pageMap, err := s.db.ReadPageMap(offset, limit)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, pageMap)
+	}
+}
+
+func handleAPIPageDetails(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.disableWriteDeadline(w)
+		id, err := parsePageID(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		content, err := s.db.ReadPage(id)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+
+		// Encode keys like rows
+		elements := []*apiPageElement{}
+		for _, elem := range content.Elements {
+			key, err := enc.Key.Encode(elem.Key)
+			if err != nil {
+				s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+				return
+			}
+			elements = append(elements, &apiPageElement{PageElement: elem, Key: key})
+		}
+		s.respondJSON(w, r, http.StatusOK, map[string]any{"page": content.Page, "elements": elements})
+	}
+}
+
+// JSON representation of a page element, with the key encoded like row keys.
+type apiPageElement struct {
+	*kvstore.PageElement
+	Key string `json:"key"`
+}
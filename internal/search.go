@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+// Search inputs, shared by the search page and the API.
+type searchRequest struct {
+	Search      *kvstore.SearchQuery
+	Query       string // regex, as entered
+	Filter      string // filter expression, as entered
+	FilterErr   *kvstore.FilterSyntaxError
+	Fields      string // comma-separated JSON paths, as entered
+	SortField   string // sort field, as entered
+	MinSize     string // value size filters, as entered
+	MaxSize     string
+	KeyEncoding kvstore.Encoding
+	KeyPrefix   string // encoded key filters, as entered
+	KeyStart    string
+	KeyEnd      string
+	PageToken   string                // empty for the first page
+	After       *kvstore.SearchCursor // decoded page token
+	PrevTokens  []string              // tokens of the previous pages (for the search page navigation)
+	Snippets    bool                  // only show text around matches (on the search page)
+	Replace     bool                  // preview the replacement of regex matches in values
+	Replacement string
+}
+
+// Parses search inputs from the request form (URL query or body).
+// Pages are requested with the "page_token" returned for the previous page.
+// Key filters ("key_prefix", "key_start" and "key_end") are decoded with "key_encoding".
+// JSON fields to project are read from "fields" (comma-separated, can be repeated).
+// Results are sorted by "sort" ("key", "value_size", "bucket" or "json.<path>") in "order" ("asc" or "desc"),
+// value sizes are filtered with "min_value_size" and "max_value_size" (in bytes or with a kb, mb or gb suffix).
+// Regex matches in values are replaced with "replacement" in a preview if "replace" is true.
+// A syntax error in the "filter" expression is reported in FilterErr (and not returned).
+func parseSearchRequest(r *http.Request) (*searchRequest, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	return parseSearchForm(r.Form)
+}
+
+// Same as parseSearchRequest, for search inputs that are not in the request form (e.g. in a hidden field).
+func parseSearchForm(form url.Values) (*searchRequest, error) {
+	var err error
+	out := &searchRequest{
+		Search:    &kvstore.SearchQuery{},
+		Query:     form.Get("query"),
+		Filter:    form.Get("filter"),
+		KeyPrefix: form.Get("key_prefix"),
+		KeyStart:  form.Get("key_start"),
+		KeyEnd:    form.Get("key_end"),
+	}
+	for _, rawPath := range form["list"] {
+		path, err := kvstore.ParseListPath(rawPath)
+		if err != nil {
+			return nil, err
+		}
+		out.Search.Lists = append(out.Search.Lists, path)
+	}
+	out.Search.Target, err = kvstore.ParseSearchTarget(form.Get("target"))
+	if err != nil {
+		return nil, err
+	}
+	if exclude := form.Get("exclude"); exclude != "" {
+		out.Search.Exclude, err = strconv.ParseBool(exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if out.PageToken = form.Get("page_token"); out.PageToken != "" {
+		out.After, err = kvstore.ParseSearchPageToken(out.PageToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out.PrevTokens = form["prev_page_token"]
+	if snippets := form.Get("snippets"); snippets != "" {
+		out.Snippets, err = strconv.ParseBool(snippets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Decode key filters
+	out.KeyEncoding, err = kvstore.ParseEncoding(form.Get("key_encoding"))
+	if err != nil {
+		return nil, err
+	}
+	keyRange, err := parseKeyRangeForm(form, out.KeyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	out.Search.KeyRange = *keyRange
+
+	// Compile regex from query if needed
+	if out.Query != "" {
+		out.Search.Regex, err = regexp.Compile(out.Query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Set up the replacement preview if needed
+	if replace := form.Get("replace"); replace != "" {
+		out.Replace, err = strconv.ParseBool(replace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out.Replacement = form.Get("replacement")
+	if out.Replace {
+		switch {
+		case out.Search.Regex == nil:
+			return nil, errors.New("find and replace requires a regex")
+		case out.Search.Target == kvstore.SearchTargetKey || out.Search.Exclude:
+			return nil, errors.New("find and replace only applies to values matching the regex")
+		}
+		out.Search.Replace = &kvstore.ValueReplacement{Regex: out.Search.Regex, Replacement: out.Replacement}
+	}
+
+	// Parse sort order and value size filters
+	out.SortField = form.Get("sort")
+	order := form.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("unknown sort order %q", order)
+	}
+	out.Search.Sort, err = kvstore.ParseSearchSort(out.SortField, order == "desc")
+	if err != nil {
+		return nil, err
+	}
+	out.MinSize, out.MaxSize = form.Get("min_value_size"), form.Get("max_value_size")
+	for _, filter := range []struct {
+		raw string
+		dst *uint64
+	}{
+		{out.MinSize, &out.Search.MinValueSize},
+		{out.MaxSize, &out.Search.MaxValueSize},
+	} {
+		if filter.raw == "" {
+			continue
+		}
+		size, err := kvstore.ParseByteSize(filter.raw)
+		if err != nil {
+			return nil, err
+		}
+		*filter.dst = uint64(size)
+	}
+
+	// Parse projected fields
+	for _, rawFields := range form["fields"] {
+		for _, rawPath := range strings.Split(rawFields, ",") {
+			if rawPath = strings.TrimSpace(rawPath); rawPath == "" {
+				continue
+			}
+			path, err := kvstore.ParseJSONPath(rawPath)
+			if err != nil {
+				return nil, err
+			}
+			out.Search.Fields = append(out.Search.Fields, path)
+		}
+	}
+	out.Fields = strings.Join(form["fields"], ",")
+
+	// Compile filter expression if needed
+	if strings.TrimSpace(out.Filter) != "" {
+		out.Search.Filter, err = kvstore.ParseFilter(out.Filter)
+		if syntaxErr := (*kvstore.FilterSyntaxError)(nil); errors.As(err, &syntaxErr) {
+			out.FilterErr = syntaxErr
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Runs the search until the request is cancelled or the search timeout is reached.
+func (s *Server) search(r *http.Request, req *searchRequest, limit int) (*kvstore.SearchResult, error) {
+	ctx := r.Context()
+	if s.searchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.searchTimeout)
+		defer cancel()
+	}
+	req.Search.Workers = s.searchWorkers
+	return kvstore.Search(ctx, s.db, req.Search, req.After, limit)
+}
+
+// Returns the path of every list in the DB (including nested ones).
+func readAllLists(db kvstore.DB) ([]kvstore.ListPath, error) {
+	lists := []kvstore.ListPath{}
+	return lists, db.ReadEachList(func(path kvstore.ListPath) error { lists = append(lists, path); return nil })
+}
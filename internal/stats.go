@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+// How long a request waits for stats to be computed before showing progress instead.
+const dbInfoWaitTimeout = 500 * time.Millisecond
+
+// Caches DB info since computing it requires reading every row.
+// Cached info is reused as long as the transaction ID is unchanged and no write was made through the GUI,
+// otherwise it is recomputed in the background.
+type dbInfoCache struct {
+	mu         sync.Mutex
+	info       *kvstore.DBInfo // last computed info (possibly outdated)
+	generation int             // incremented on each write made through the GUI
+	infoGen    int             // generation of the cached info
+	running    *dbInfoComputation
+}
+
+type dbInfoComputation struct {
+	estimate   bool
+	generation int
+	done       chan struct{} // closed once the computation is finished
+	progress   [2]int        // lists done and total
+	err        error
+}
+
+// Snapshot of the cache state, used to render the page.
+type dbInfoStatus struct {
+	Info      *kvstore.DBInfo // nil if never computed
+	Outdated  bool            // the info is being recomputed
+	Done      int             // lists done by the running computation
+	Total     int             // total number of lists for the running computation
+	Err       error           // error of the last computation
+	Estimated bool
+}
+
+func newDBInfoCache() *dbInfoCache { return &dbInfoCache{} }
+
+// Marks the cached info as outdated.
+func (c *dbInfoCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+}
+
+// Returns the cached info if it is up-to-date, otherwise starts a computation (if none is running)
+// and waits up to the given duration for it to finish (or until it is finished if wait is zero).
+func (c *dbInfoCache) load(ctx context.Context, db kvstore.DB, estimate bool, wait time.Duration) (*dbInfoStatus, error) {
+	txID, err := db.TxID()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.isFresh(txID, estimate) {
+		defer c.mu.Unlock()
+		return &dbInfoStatus{Info: c.info, Estimated: c.info.Estimated}, nil
+	}
+	comp := c.running
+	if comp == nil || comp.estimate != estimate || comp.generation != c.generation {
+		comp = c.start(db, estimate)
+	}
+	c.mu.Unlock()
+
+	// Wait for computation
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-comp.done:
+	case <-timeout:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := &dbInfoStatus{Info: c.info, Estimated: estimate}
+	select {
+	case <-comp.done:
+		status.Err = comp.err
+		status.Outdated = !c.isFresh(txID, estimate)
+	default:
+		status.Outdated = true
+		status.Done, status.Total = comp.progress[0], comp.progress[1]
+	}
+	return status, nil
+}
+
+// Reports whether the cached info can be used, c.mu must be held.
+func (c *dbInfoCache) isFresh(txID int, estimate bool) bool {
+	return c.info != nil && c.infoGen == c.generation && c.info.TxID == txID && c.info.Estimated == estimate
+}
+
+// Starts computing info in the background, c.mu must be held.
+// A computation that is already running is not stopped but its result is discarded if it finished last.
+func (c *dbInfoCache) start(db kvstore.DB, estimate bool) *dbInfoComputation {
+	comp := &dbInfoComputation{estimate: estimate, generation: c.generation, done: make(chan struct{})}
+	c.running = comp
+	go func() {
+		defer close(comp.done)
+		info, err := kvstore.GetDBInfoWithOptions(db, &kvstore.DBInfoOptions{
+			Estimate: estimate,
+			OnProgress: func(done, total int) {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				comp.progress = [2]int{done, total}
+			},
+		})
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		comp.err = err
+		if err == nil && c.running == comp {
+			c.info, c.infoGen = info, comp.generation
+		}
+		if c.running == comp {
+			c.running = nil
+		}
+	}()
+	return comp
+}
+
+// Invalidates cached DB info after requests that may write to the DB.
+func (s *Server) invalidateDBInfoMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			s.dbInfoCache.invalidate()
+		}
+	})
+}
+
+// Returns the "estimate" URL query parameter.
+func parseEstimateParam(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("estimate") {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid estimate parameter %q", r.URL.Query().Get("estimate"))
+}
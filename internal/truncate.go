@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+// Deletes the rows of a list in the key range, or all its rows if the range is empty.
+func (s *Server) deleteRowsInRange(list kvstore.ListPath, keyRange *kvstore.KeyRange, dryRun bool) (*kvstore.WriteReport, error) {
+	if keyRange.IsEmpty() {
+		return s.db.TruncateList(list, dryRun)
+	}
+	return s.db.DeleteRowsInRange(list, keyRange, dryRun)
+}
+
+func serveDBBucketDeleteRowsPage(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-bucket-delete-rows.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.db.ReadOnly() {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusForbidden, kvstore.ErrReadOnly)
+			return
+		}
+		path, err := kvstore.ParseListPath(r.URL.Query().Get("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{
+			"Breadcrumbs": newListBreadcrumbs(path),
+			"Bucket":      path,
+			"Encodings":   kvstore.Encodings,
+			"KeyEncoding": kvstore.EncodingText,
+		})
+	}
+}
+
+// Counts the rows to delete in the bucket "id" and the key range (see parseKeyRangeForm) and asks for confirmation,
+// then deletes them once "confirm" is true. All rows are deleted if the range is empty.
+func handleDBBucketDeleteRowsForm(s *Server) http.HandlerFunc {
+	tmpl := mustParseTmpl(layoutTmpls, tmplDirPath, "db-bucket-delete-rows.gohtml")
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		path, err := kvstore.ParseListPath(r.FormValue("id"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		keyEncoding, err := kvstore.ParseEncoding(r.FormValue("key_encoding"))
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+		keyRange, err := parseKeyRangeForm(r.Form, keyEncoding)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		confirmed := r.FormValue("confirm") == "true"
+		report, err := s.deleteRowsInRange(path, keyRange, !confirmed)
+		if err != nil {
+			s.respondErrorPageHTMLTmpl(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondPageOK(w, r, tmpl, map[string]any{
+			"Breadcrumbs": newListBreadcrumbs(path),
+			"Bucket":      path,
+			"Encodings":   kvstore.Encodings,
+			"KeyEncoding": keyEncoding,
+			"KeyPrefix":   r.FormValue("key_prefix"),
+			"KeyStart":    r.FormValue("key_start"),
+			"KeyEnd":      r.FormValue("key_end"),
+			"Report":      report,
+			"Done":        confirmed,
+		})
+	}
+}
+
+// Parses the "dry_run" URL query parameter (false by default).
+func parseDryRunParam(urlQueryParams url.Values) (bool, error) {
+	rawDryRun := urlQueryParams.Get("dry_run")
+	if rawDryRun == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(rawDryRun)
+}
+
+// Deletes the rows of the bucket in the key range (set with "key_prefix", "key_start" and "key_end").
+// The range can't be empty, so a missing or misspelled parameter doesn't delete all rows (see handleAPITruncateBucket).
+func handleAPIDeleteRowRange(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		enc, err := parseAPIEncodings(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		keyRange, err := parseKeyRangeForm(r.URL.Query(), enc.Key)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		} else if keyRange.IsEmpty() {
+			err = errors.New("missing key_prefix, key_start or key_end (use POST /api/v1/buckets/truncate to delete all rows)")
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		dryRun, err := parseDryRunParam(r.URL.Query())
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		report, err := s.db.DeleteRowsInRange(path, keyRange, dryRun)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, report)
+	}
+}
+
+// Deletes all rows of the bucket (its nested buckets and sequence are kept).
+func handleAPITruncateBucket(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := parseAPIBucket(r)
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+		dryRun, err := parseDryRunParam(r.URL.Query())
+		if err != nil {
+			s.respondErrorJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		report, err := s.db.TruncateList(path, dryRun)
+		if err != nil {
+			s.respondErrorJSON(w, r, statusCodeFromDBError(err), err)
+			return
+		}
+		s.respondJSON(w, r, http.StatusOK, report)
+	}
+}
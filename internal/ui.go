@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strings"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
 )
 
 const tmplDirPath = "gohtml"
@@ -16,15 +19,43 @@ var layoutTmpls = []string{
 	filepath.Join(tmplDirPath, "_css.gohtml"),
 	filepath.Join(tmplDirPath, "_header.gohtml"),
 	filepath.Join(tmplDirPath, "_footer.gohtml"),
+	filepath.Join(tmplDirPath, "_row.gohtml"),
+	filepath.Join(tmplDirPath, "_export.gohtml"),
 }
 
 func mustParseTmpl(commonTmpls []string, tmplDirPath, fname string) *template.Template {
 	t := template.New(fname).Funcs(template.FuncMap{
 		"QueryEscape": url.QueryEscape,
+		"mul100":      func(f float64) float64 { return f * 100 },
+		"highlight":   highlightMatches,
+		"snippets": func(text string, matches []kvstore.MatchRange) []*kvstore.Snippet {
+			return kvstore.Snippets(text, matches, snippetContext)
+		},
 	})
 	return template.Must(t.ParseFiles(append(commonTmpls, filepath.Join(tmplDirPath, fname))...))
 }
 
+// Number of bytes shown before and after each match in search result snippets.
+const snippetContext = 80
+
+// Escapes the text and wraps matches in <mark> elements.
+func highlightMatches(text string, matches []kvstore.MatchRange) template.HTML {
+	b := &strings.Builder{}
+	pos := 0
+	for _, m := range matches {
+		if m.Start < pos || m.End > len(text) {
+			continue // overlapping or out of bounds
+		}
+		b.WriteString(template.HTMLEscapeString(text[pos:m.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[m.Start:m.End]))
+		b.WriteString("</mark>")
+		pos = m.End
+	}
+	b.WriteString(template.HTMLEscapeString(text[pos:]))
+	return template.HTML(b.String())
+}
+
 // Will panic when an error occurs during rendering, make sure you handle panic recovery in a middleware.
 func (s *Server) respondHTMLTmpl(
 	w http.ResponseWriter,
@@ -40,9 +71,10 @@ func (s *Server) respondHTMLTmpl(
 		data = map[string]any{}
 	}
 	err := t.ExecuteTemplate(w, tname, map[string]any{
-		"DBPath":  s.db.DiskPath(),
-		"Request": r,
-		"Local":   data,
+		"DBPath":   s.db.DiskPath(),
+		"ReadOnly": s.db.ReadOnly(),
+		"Request":  r,
+		"Local":    data,
 	})
 	if err != nil {
 		w.Write([]byte(err.Error()))
@@ -65,3 +97,18 @@ func (s *Server) respondErrorPageHTMLTmpl(w http.ResponseWriter, r *http.Request
 func (s *Server) respondPageOK(w http.ResponseWriter, r *http.Request, t *template.Template, data any) {
 	s.respondHTMLTmpl(w, r, http.StatusOK, t, tmplLayoutKey, data)
 }
+
+// Flushes each write to the client, used to stream pages that take a while to render.
+type flushingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (fw *flushingResponseWriter) Write(b []byte) (int, error) {
+	n, err := fw.ResponseWriter.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, http.NewResponseController(fw.ResponseWriter).Flush()
+}
+
+func (fw *flushingResponseWriter) Unwrap() http.ResponseWriter { return fw.ResponseWriter }
@@ -1,8 +1,65 @@
 package internal
 
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
 type Breadcrumbs []Breadcrumb
 
 type Breadcrumb struct {
 	Name string
 	Path string
 }
+
+// Returns breadcrumbs leading to the given bucket, each parent bucket links to its own page.
+func newListBreadcrumbs(path kvstore.ListPath) Breadcrumbs {
+	out := Breadcrumbs{{Name: "DB buckets", Path: "/db"}}
+	for _, ancestor := range path.Ancestors() {
+		out = append(out, Breadcrumb{Name: ancestor.Name(), Path: "/db/bucket?id=" + url.QueryEscape(ancestor.String())})
+	}
+	return out
+}
+
+// Returns a copy of the breadcrumbs where the last one is not a link (used for the current page).
+func (b Breadcrumbs) WithoutLastLink() Breadcrumbs {
+	out := append(Breadcrumbs{}, b...)
+	if len(out) > 0 {
+		out[len(out)-1].Path = ""
+	}
+	return out
+}
+
+// Decodes a form value using the encoding selected in the associated "<name>_encoding" field (text by default).
+func decodeFormValue(r *http.Request, name string) ([]byte, error) {
+	enc, err := kvstore.ParseEncoding(r.FormValue(name + "_encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return enc.Decode(r.FormValue(name))
+}
+
+// Decodes the key range set in the form fields "key_prefix", "key_start" and "key_end" with the given encoding.
+func parseKeyRangeForm(form url.Values, enc kvstore.Encoding) (*kvstore.KeyRange, error) {
+	out := &kvstore.KeyRange{}
+	for _, filter := range []struct {
+		raw string
+		dst *kvstore.RowKey
+	}{
+		{form.Get("key_prefix"), &out.Prefix},
+		{form.Get("key_start"), &out.Start},
+		{form.Get("key_end"), &out.End},
+	} {
+		if filter.raw == "" {
+			continue
+		}
+		var err error
+		*filter.dst, err = enc.Decode(filter.raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
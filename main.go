@@ -1,9 +1,9 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/ejuju/boltdb-webgui/internal"
@@ -14,15 +14,19 @@ func init() {
 }
 
 func main() {
-	fpath := "test.boltdb"
+	config := &internal.Config{DBPath: "test.boltdb"}
 	port := "8080"
-	if len(os.Args) >= 2 {
-		fpath = os.Args[1]
+	flag.BoolVar(&config.ReadOnly, "read-only", false, "open the database in read-only mode (shared lock, writes are rejected)")
+	flag.DurationVar(&config.SearchTimeout, "search-timeout", 10*time.Second, "return partial search results after this delay (0 for no limit)")
+	flag.IntVar(&config.SearchWorkers, "search-workers", 4, "number of buckets searched concurrently")
+	flag.Parse()
+	if flag.NArg() >= 1 {
+		config.DBPath = flag.Arg(0)
 	}
-	if len(os.Args) >= 3 {
-		port = os.Args[2]
+	if flag.NArg() >= 2 {
+		port = flag.Arg(1)
 	}
-	server := internal.NewServer(fpath)
+	server := internal.NewServer(config)
 	httpServer := &http.Server{
 		Addr:              ":" + port,
 		Handler:           server.NewHTTPHandler(),
@@ -0,0 +1,102 @@
+package boltutil
+
+import (
+	"errors"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+// ApplyToRows finds all matching rows first, then applies the operation to them in the same transaction.
+func (db *KeyValueDB) ApplyToRows(
+	lists []kvstore.ListPath,
+	keyRange *kvstore.KeyRange,
+	match kvstore.RowMatcher,
+	op *kvstore.BulkOperation,
+	dryRun bool,
+) (*kvstore.WriteReport, error) {
+	report := &kvstore.WriteReport{}
+	return report, db.updateOrDryRun(dryRun, func(tx *bbolt.Tx) error {
+		// Find matching rows (copied since they are modified while iterating)
+		type matchedRow struct {
+			b    *bbolt.Bucket
+			list kvstore.ListPath
+			row  *kvstore.Row
+		}
+		matched := []*matchedRow{}
+		for _, list := range lists {
+			b, err := findBucket(tx, list)
+			if err != nil {
+				return err
+			}
+			err = eachRowInRange(b, keyRange, func(r *kvstore.Row) error {
+				if match(list, r) {
+					row := &kvstore.Row{Key: copyBytes(r.Key), Value: copyBytes(r.Value)}
+					matched = append(matched, &matchedRow{b: b, list: list, row: row})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		report.Matched = len(matched)
+		if len(matched) == 0 {
+			return nil
+		}
+
+		// Apply operation
+		if op.Action == kvstore.BulkReplace && op.Replace == nil {
+			return errors.New("missing replacement")
+		}
+		var target *bbolt.Bucket
+		if op.Action == kvstore.BulkCopy || op.Action == kvstore.BulkMove {
+			var err error
+			target, err = createBucketPath(tx, op.Target, report)
+			if err != nil {
+				return err
+			}
+		}
+		for _, m := range matched {
+			switch op.Action {
+			case kvstore.BulkDelete:
+				report.Deleted++
+				err := m.b.Delete(m.row.Key)
+				if err != nil {
+					return err
+				}
+			case kvstore.BulkCopy, kvstore.BulkMove:
+				if op.Action == kvstore.BulkMove && m.list.String() == op.Target.String() {
+					report.Skipped++ // already in the target bucket
+					continue
+				}
+				skipped := report.Skipped
+				err := putRow(target, m.row, op.OnConflict, report)
+				if err != nil {
+					return err
+				}
+				if op.Action == kvstore.BulkMove && report.Skipped == skipped {
+					report.Deleted++
+					err = m.b.Delete(m.row.Key)
+					if err != nil {
+						return err
+					}
+				}
+			case kvstore.BulkReplace:
+				newValue, changed := op.Replace.Apply(m.row.Value)
+				if !changed {
+					report.Skipped++
+					continue
+				}
+				report.Updated++
+				err := updateRow(tx, m.list, m.row.Key, newValue)
+				if err != nil {
+					return err
+				}
+			default:
+				return errors.New("unknown bulk action " + string(op.Action))
+			}
+		}
+		return nil
+	})
+}
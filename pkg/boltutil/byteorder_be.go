@@ -0,0 +1,8 @@
+//go:build armbe || arm64be || m68k || mips || mips64 || mips64p32 || ppc || ppc64 || s390 || s390x || shbe || sparc || sparc64
+
+package boltutil
+
+import "encoding/binary"
+
+// Byte order of bbolt pages (the host byte order).
+var pageByteOrder = binary.BigEndian
@@ -0,0 +1,132 @@
+package boltutil
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+// Matches page IDs in bbolt check messages (e.g. "page 12: unreachable unfreed" or "on leaf page(12)"),
+// the page stacks included in some messages are ignored.
+var checkPageIDRegexp = regexp.MustCompile(`(?:page |page\(|pgId:)(\d+)`)
+
+// Minimum delay between two progress reports of an integrity check.
+const checkProgressInterval = time.Second
+
+// Check verifies the consistency of the DB file in a read transaction.
+// onIssue is called for each inconsistency found, the check continues when it returns an error
+// but onIssue and onProgress are not called anymore and the error is returned at the end.
+// onProgress (may be nil) is called at most every checkProgressInterval.
+//
+// bbolt doesn't report the progress of tx.Check, so the B+trees are read beforehand
+// (reporting the number of pages read), which also maps issues to the list owning their pages.
+// tx.Check is skipped if invalid pages are found while reading the B+trees.
+func (db *KeyValueDB) Check(onIssue func(*kvstore.CheckIssue) error, onProgress func(*kvstore.CheckProgress)) (*kvstore.CheckReport, error) {
+	before := time.Now()
+	report := &kvstore.CheckReport{}
+	progress := &kvstore.CheckProgress{}
+	lastProgress := before
+	var callbackErr error
+	reportProgress := func(force bool) {
+		if onProgress == nil || callbackErr != nil || (!force && time.Since(lastProgress) < checkProgressInterval) {
+			return
+		}
+		lastProgress = time.Now()
+		progress.NumIssues, progress.Elapsed = report.NumIssues, time.Since(before)
+		p := *progress
+		onProgress(&p)
+	}
+	err := db.viewPages(func(tx *bbolt.Tx, pr *pageReader) error {
+		report.NumPages = int(tx.Size() / int64(pr.pageSize))
+		progress.NumPages = report.NumPages
+
+		// Read the B+trees, pages that can't be read are reported as issues and skipped
+		pr.onRead = func(numPages int) {
+			progress.PagesRead += numPages
+			reportProgress(false)
+		}
+		walkIssues := []*kvstore.CheckIssue{}
+		pr.onError = func(err error) {
+			report.VerifySkipped = report.VerifySkipped || errors.Is(err, errInvalidPage)
+			walkIssues = append(walkIssues, newCheckIssue(err))
+		}
+		owners, err := pr.walkOwners(tx)
+		if err != nil {
+			return err
+		}
+		pr.onRead, pr.onError = nil, nil
+		report.PagesRead = progress.PagesRead
+		for _, issue := range walkIssues {
+			report.NumIssues++
+			if callbackErr == nil {
+				if len(issue.PageIDs) > 0 {
+					issue.List = owners[issue.PageIDs[0]]
+				}
+				callbackErr = onIssue(issue)
+			}
+		}
+		if report.VerifySkipped {
+			return nil // bbolt doesn't check bounds when reading pages, tx.Check could crash or exhaust memory
+		}
+
+		progress.Verifying = true
+		reportProgress(true)
+		ticker := time.NewTicker(checkProgressInterval)
+		defer ticker.Stop()
+		// Always drain the channel, otherwise the checking goroutine is leaked
+		issues := tx.Check()
+		for {
+			select {
+			case err, ok := <-issues:
+				if !ok {
+					return nil
+				}
+				report.NumIssues++
+				if callbackErr == nil {
+					issue := newCheckIssue(err)
+					if len(issue.PageIDs) > 0 {
+						issue.List = owners[issue.PageIDs[0]]
+					}
+					callbackErr = onIssue(issue)
+				}
+			case <-ticker.C:
+				reportProgress(true)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Duration = time.Since(before)
+	return report, callbackErr
+}
+
+func newCheckIssue(err error) *kvstore.CheckIssue {
+	msg := err.Error()
+	issue := &kvstore.CheckIssue{Message: msg, Kind: kvstore.CheckIssueOther}
+	switch {
+	case strings.Contains(msg, "unreachable"):
+		issue.Kind = kvstore.CheckIssueUnreachable
+	case strings.Contains(msg, "freed"):
+		issue.Kind = kvstore.CheckIssueFreelist
+	case strings.HasPrefix(msg, "key[") || strings.HasPrefix(msg, "the first key["):
+		issue.Kind = kvstore.CheckIssueKeyOrder
+	}
+
+	// Extract page IDs (without the page stack)
+	if i := strings.Index(strings.ToLower(msg), "stack:"); i >= 0 {
+		msg = msg[:i]
+	}
+	for _, match := range checkPageIDRegexp.FindAllStringSubmatch(msg, -1) {
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err == nil {
+			issue.PageIDs = append(issue.PageIDs, id)
+		}
+	}
+	return issue
+}
@@ -0,0 +1,113 @@
+package boltutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+// Maximum size of the transactions used to copy data to the compacted file.
+const compactTxMaxSize = 64 << 20
+
+// Maximum time to wait for reads in progress before swapping the compacted file.
+const compactSwapTimeout = 10 * time.Second
+
+// FreeSize returns the size of the pages on the freelist (including pages pending release).
+func (db *KeyValueDB) FreeSize() (uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.err != nil {
+		return 0, db.err
+	}
+	stats := db.f.Stats()
+	return uint64(stats.FreePageN+stats.PendingPageN) * uint64(db.f.Info().PageSize), nil
+}
+
+// Compact copies all buckets to a new file, replaces the DB file with it and reopens the DB.
+// Writes wait until the compaction is done but reads continue while the data is copied,
+// the DB file is only swapped once no read is in progress (kvstore.ErrBusy is returned
+// if reads are still in progress after compactSwapTimeout).
+// The original file is left untouched if an error occurs before the swap.
+// If the DB file can't be reopened after the swap, all operations return an error until the DB is reopened.
+func (db *KeyValueDB) Compact() (*kvstore.CompactReport, error) {
+	if db.readOnly {
+		return nil, kvstore.ErrReadOnly
+	}
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	before := time.Now()
+	report := &kvstore.CompactReport{}
+	fstats, err := os.Stat(db.path)
+	if err != nil {
+		return nil, err
+	}
+	report.DiskSizeBefore = uint64(fstats.Size())
+
+	// Copy data to a temporary file in the same directory (so the file can be renamed atomically)
+	tmpf, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".compact-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmpf.Name()
+	tmpf.Close()
+	defer os.Remove(tmpPath) // no-op once renamed
+	err = os.Chmod(tmpPath, fstats.Mode())
+	if err != nil {
+		return nil, err
+	}
+	dst, err := bbolt.Open(tmpPath, fstats.Mode(), &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	// bbolt.Compact reads from its own transaction, the view only keeps the DB file from being closed
+	err = db.view(func(*bbolt.Tx) error { return bbolt.Compact(dst, db.f, compactTxMaxSize) })
+	if err != nil {
+		dst.Close()
+		return nil, fmt.Errorf("compact: %w", err)
+	}
+	err = dst.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for reads in progress without blocking new ones
+	// (a pending Lock would make new reads wait for the slowest read in progress, an export for example).
+	deadline := time.Now().Add(compactSwapTimeout)
+	for !db.mu.TryLock() {
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("swap compacted file: %w", kvstore.ErrBusy)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer db.mu.Unlock()
+
+	// Swap files and reopen
+	db.pageOwners.owners = nil // transaction IDs of the compacted file are unrelated
+	err = db.f.Close()
+	if err != nil {
+		db.err = fmt.Errorf("close DB file for compaction: %w", err)
+		return nil, db.err
+	}
+	renameErr := os.Rename(tmpPath, db.path) // the original file is reopened if the rename failed
+	db.f, err = openBoltDB(db.path, db.readOnly)
+	if err != nil {
+		db.err = fmt.Errorf("reopen DB file after compaction (restart the server): %w", err)
+		return nil, db.err
+	}
+	if renameErr != nil {
+		return nil, renameErr
+	}
+
+	fstats, err = os.Stat(db.path)
+	if err != nil {
+		return nil, err
+	}
+	report.DiskSizeAfter = uint64(fstats.Size())
+	report.Duration = time.Since(before)
+	return report, nil
+}
@@ -0,0 +1,264 @@
+package boltutil
+
+import (
+	"bytes"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+func (db *KeyValueDB) ReadRowCursor(list kvstore.ListPath, cursor *kvstore.RowCursor) (*kvstore.RowCursorPage, error) {
+	out := &kvstore.RowCursorPage{}
+	return out, db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		c := &rowCursor{c: b.Cursor(), prefix: cursor.Prefix, reverse: cursor.Reverse}
+
+		// Find first row of the page
+		var k, v []byte
+		switch {
+		case cursor.Last:
+			k, v = c.last()
+			for i := 1; i < cursor.Limit && k != nil; i++ {
+				prevK, prevV := c.prev()
+				if prevK == nil {
+					break
+				}
+				k, v = prevK, prevV
+			}
+			if k != nil {
+				k, v = c.seek(k) // re-position cursor after reaching the beginning
+			}
+		case cursor.Seek != nil && bytes.HasPrefix(cursor.Seek, cursor.Prefix):
+			k, v = c.seek(cursor.Seek)
+		default:
+			k, v = c.first()
+		}
+		if k == nil {
+			return nil
+		}
+		firstKey := copyBytes(k)
+
+		// Read rows and set next page key
+		for ; k != nil && len(out.Rows) < cursor.Limit; k, v = c.next() {
+			out.Rows = append(out.Rows, &kvstore.Row{Key: copyBytes(k), Value: copyBytes(v)})
+		}
+		if k != nil {
+			out.Next = copyBytes(k)
+		}
+
+		// Walk back from the first row to find the previous page key
+		c.seek(firstKey)
+		for i := 0; i < cursor.Limit; i++ {
+			k, _ := c.prev()
+			if k == nil {
+				break
+			}
+			out.Prev = copyBytes(k)
+		}
+		return nil
+	})
+}
+
+// rowCursor wraps a bbolt cursor to iterate over rows in a given direction,
+// skipping nested buckets and keys that don't match the prefix.
+type rowCursor struct {
+	c       *bbolt.Cursor
+	prefix  []byte
+	reverse bool
+}
+
+func (c *rowCursor) first() ([]byte, []byte) {
+	if c.reverse {
+		k, v := c.lastInPrefix()
+		return c.skip(k, v, true)
+	}
+	k, v := c.firstInPrefix()
+	return c.skip(k, v, false)
+}
+
+func (c *rowCursor) last() ([]byte, []byte) {
+	if c.reverse {
+		k, v := c.firstInPrefix()
+		return c.skip(k, v, false)
+	}
+	k, v := c.lastInPrefix()
+	return c.skip(k, v, true)
+}
+
+func (c *rowCursor) next() ([]byte, []byte) { return c.step(c.reverse) }
+func (c *rowCursor) prev() ([]byte, []byte) { return c.step(!c.reverse) }
+
+// Positions the cursor on the given key, or on the closest one following it in the iteration order.
+func (c *rowCursor) seek(key []byte) ([]byte, []byte) {
+	k, v := c.c.Seek(key)
+	if !c.reverse {
+		return c.skip(k, v, false)
+	}
+	if k == nil {
+		k, v = c.c.Last()
+	} else if !bytes.Equal(k, key) {
+		k, v = c.c.Prev()
+	}
+	return c.skip(k, v, true)
+}
+
+func (c *rowCursor) step(backward bool) ([]byte, []byte) {
+	if backward {
+		k, v := c.c.Prev()
+		return c.skip(k, v, true)
+	}
+	k, v := c.c.Next()
+	return c.skip(k, v, false)
+}
+
+// Moves past nested buckets (nil values) and returns nil once outside of the prefix.
+func (c *rowCursor) skip(k, v []byte, backward bool) ([]byte, []byte) {
+	for k != nil && v == nil {
+		if backward {
+			k, v = c.c.Prev()
+		} else {
+			k, v = c.c.Next()
+		}
+	}
+	if k == nil || !bytes.HasPrefix(k, c.prefix) {
+		return nil, nil
+	}
+	return k, v
+}
+
+func (c *rowCursor) firstInPrefix() ([]byte, []byte) {
+	if len(c.prefix) == 0 {
+		return c.c.First()
+	}
+	return c.c.Seek(c.prefix)
+}
+
+func (c *rowCursor) lastInPrefix() ([]byte, []byte) {
+	end := prefixEnd(c.prefix)
+	if end == nil {
+		return c.c.Last()
+	}
+	k, _ := c.c.Seek(end)
+	if k == nil {
+		return c.c.Last()
+	}
+	return c.c.Prev()
+}
+
+// Returns the smallest key greater than every key starting with the prefix,
+// or nil if there is none (empty prefix or prefix only made of 0xff bytes).
+func prefixEnd(prefix []byte) []byte {
+	end := copyBytes(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// Copies bytes returned by bbolt since they are only valid during the transaction.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// ReadEachRowInRange calls the callback for each row in the key range,
+// the cursor seeks to the first key of the range instead of scanning the whole bucket.
+func (db *KeyValueDB) ReadEachRowInRange(list kvstore.ListPath, keyRange *kvstore.KeyRange, callback func(*kvstore.Row) error) error {
+	return db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		return eachRowInRange(b, keyRange, callback)
+	})
+}
+
+// ReadEachRowInLists calls the callback for each row in the key range of each list,
+// all lists are read in a single transaction so the rows come from a consistent snapshot.
+func (db *KeyValueDB) ReadEachRowInLists(lists []kvstore.ListPath, keyRange *kvstore.KeyRange, callback func(kvstore.ListPath, *kvstore.Row) error) error {
+	return db.view(func(tx *bbolt.Tx) error {
+		for _, list := range lists {
+			b, err := findBucket(tx, list)
+			if err != nil {
+				return err
+			}
+			err = eachRowInRange(b, keyRange, func(r *kvstore.Row) error { return callback(list, r) })
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Calls the callback for each row of the bucket in the key range (nested buckets are skipped).
+func eachRowInRange(b *bbolt.Bucket, keyRange *kvstore.KeyRange, callback func(*kvstore.Row) error) error {
+	c := b.Cursor()
+	for k, v := seekRange(c, keyRange); k != nil && !pastRange(keyRange, k); k, v = c.Next() {
+		if v == nil {
+			continue // skip nested buckets
+		}
+		err := callback(&kvstore.Row{Key: k, Value: v})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Moves the cursor to the first key of the range (from the greatest of the prefix and the lower bound).
+func seekRange(c *bbolt.Cursor, keyRange *kvstore.KeyRange) ([]byte, []byte) {
+	start := []byte(keyRange.Prefix)
+	if bytes.Compare(keyRange.Start, start) > 0 {
+		start = keyRange.Start
+	}
+	if len(start) == 0 {
+		return c.First()
+	}
+	return c.Seek(start)
+}
+
+// Reports whether the key is after the range (keys are sorted so no other key can be in the range).
+func pastRange(keyRange *kvstore.KeyRange, k []byte) bool {
+	return !bytes.HasPrefix(k, keyRange.Prefix) || (len(keyRange.End) > 0 && bytes.Compare(k, keyRange.End) >= 0)
+}
+
+// DeleteRowsInRange deletes each row in the key range with a cursor (nested buckets are kept).
+func (db *KeyValueDB) DeleteRowsInRange(list kvstore.ListPath, keyRange *kvstore.KeyRange, dryRun bool) (*kvstore.WriteReport, error) {
+	report := &kvstore.WriteReport{}
+	return report, db.updateOrDryRun(dryRun, func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		c := b.Cursor()
+		k, v := seekRange(c, keyRange)
+		for k != nil && !pastRange(keyRange, k) {
+			if v == nil {
+				k, v = c.Next() // skip nested buckets
+				continue
+			}
+			key := copyBytes(k)
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+			report.Deleted++
+			k, v = c.Seek(key) // the cursor position is not reliable after a deletion
+		}
+		return nil
+	})
+}
+
+// TruncateList deletes all rows of the list, its nested lists and sequence are kept.
+func (db *KeyValueDB) TruncateList(list kvstore.ListPath, dryRun bool) (*kvstore.WriteReport, error) {
+	return db.DeleteRowsInRange(list, &kvstore.KeyRange{}, dryRun)
+}
@@ -1,8 +1,11 @@
 package boltutil
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
@@ -10,23 +13,92 @@ import (
 )
 
 type KeyValueDB struct {
-	f *bbolt.DB
+	mu       sync.RWMutex // write-locked while the DB file is swapped (see Compact)
+	writeMu  sync.RWMutex // write-locked while the DB is compacted, locked before mu
+	f        *bbolt.DB
+	err      error // set if the DB file couldn't be reopened after a compaction, returned by all operations
+	path     string
+	readOnly bool
+
+	pageOwners pageOwnersCache
 }
 
-func NewKeyValueDB(fpath string) *KeyValueDB {
+// NewKeyValueDB opens the given DB file.
+// In read-only mode, the file is opened with a shared lock (so it can be opened by another process at the same time)
+// and all write operations return kvstore.ErrReadOnly.
+func NewKeyValueDB(fpath string, readOnly bool) *KeyValueDB {
 	// Open DB file
-	f, err := bbolt.Open(fpath, os.ModePerm, &bbolt.Options{Timeout: 2 * time.Second})
+	f, err := openBoltDB(fpath, readOnly)
 	if err != nil {
 		panic(fmt.Errorf("open DB file: %w", err))
 	}
-	return &KeyValueDB{f: f}
+	return &KeyValueDB{f: f, path: fpath, readOnly: readOnly}
+}
+
+func openBoltDB(fpath string, readOnly bool) (*bbolt.DB, error) {
+	return bbolt.Open(fpath, os.ModePerm, &bbolt.Options{
+		Timeout:         2 * time.Second,
+		ReadOnly:        readOnly,
+		PreLoadFreelist: true, // required for free page stats and page maps in read-only mode
+	})
+}
+
+// Runs fn in a read-only transaction.
+func (db *KeyValueDB) view(fn func(*bbolt.Tx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.err != nil {
+		return db.err
+	}
+	return db.f.View(fn)
+}
+
+// Runs fn in a read-write transaction, or returns kvstore.ErrReadOnly if the DB was opened in read-only mode.
+func (db *KeyValueDB) update(fn func(*bbolt.Tx) error) error {
+	if db.readOnly {
+		return kvstore.ErrReadOnly
+	}
+	db.writeMu.RLock()
+	defer db.writeMu.RUnlock()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.err != nil {
+		return db.err
+	}
+	return db.f.Update(fn)
 }
 
-func (db *KeyValueDB) Close() error { return db.f.Close() }
+// Same as update, but the transaction is rolled back instead of committed when dryRun is true.
+func (db *KeyValueDB) updateOrDryRun(dryRun bool, fn func(*bbolt.Tx) error) error {
+	if !dryRun {
+		return db.update(fn)
+	}
+	if db.readOnly {
+		return kvstore.ErrReadOnly
+	}
+	// Dry runs don't change data so they don't wait for compactions
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.err != nil {
+		return db.err
+	}
+	tx, err := db.f.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+func (db *KeyValueDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.f.Close()
+}
 
 func (db *KeyValueDB) Size() (uint64, error) {
 	out := uint64(0)
-	return out, db.f.View(func(tx *bbolt.Tx) error {
+	return out, db.view(func(tx *bbolt.Tx) error {
 		out = uint64(tx.Size())
 		return nil
 	})
@@ -34,7 +106,7 @@ func (db *KeyValueDB) Size() (uint64, error) {
 
 func (db *KeyValueDB) DiskSize() (uint64, error) {
 	out := uint64(0)
-	return out, db.f.View(func(tx *bbolt.Tx) error {
+	return out, db.view(func(tx *bbolt.Tx) error {
 		fstats, err := os.Stat(tx.DB().Path())
 		if err != nil {
 			return err
@@ -44,54 +116,173 @@ func (db *KeyValueDB) DiskSize() (uint64, error) {
 	})
 }
 
-func (db *KeyValueDB) DiskPath() string { return db.f.Path() }
+func (db *KeyValueDB) DiskPath() string { return db.path }
 
+// Backup streams a copy of the whole DB file from a read transaction,
+// so other read and write transactions are not blocked while the snapshot is written
+// (a compaction can't swap the DB file until the backup is done).
+func (db *KeyValueDB) Backup(w io.Writer, onStart func(size int64)) (int64, error) {
+	n := int64(0)
+	err := db.view(func(tx *bbolt.Tx) error {
+		if onStart != nil {
+			onStart(tx.Size())
+		}
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+func (db *KeyValueDB) ReadOnly() bool { return db.readOnly }
+
+// NumLists returns the total number of buckets, including nested ones.
 func (db *KeyValueDB) NumLists() (int, error) {
 	out := 0
-	return out, db.f.View(func(tx *bbolt.Tx) error {
-		return tx.ForEach(func(_ []byte, _ *bbolt.Bucket) error { out++; return nil })
-	})
+	return out, db.ReadEachList(func(_ kvstore.ListPath) error { out++; return nil })
 }
 
-func (db *KeyValueDB) NumRows(list string) (uint64, error) {
+// NumRows returns the number of key-value pairs in a bucket, nested buckets are not counted.
+func (db *KeyValueDB) NumRows(list kvstore.ListPath) (uint64, error) {
 	out := uint64(0)
-	return out, db.f.View(func(tx *bbolt.Tx) error {
-		b, err := findBucket(tx, []byte(list))
+	return out, db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
 		if err != nil {
 			return err
 		}
-		out = uint64(b.Stats().KeyN)
-		return nil
+		return b.ForEach(func(_, v []byte) error {
+			if v != nil {
+				out++
+			}
+			return nil
+		})
+	})
+}
+
+// ListExists reports whether the bucket exists, without reading its rows.
+func (db *KeyValueDB) ListExists(list kvstore.ListPath) (bool, error) {
+	out := false
+	return out, db.view(func(tx *bbolt.Tx) error {
+		_, err := findBucket(tx, list)
+		if errors.Is(err, kvstore.ErrNotFound) {
+			return nil
+		}
+		out = err == nil
+		return err
 	})
 }
 
-func (db *KeyValueDB) CreateList(name string) error {
-	return db.f.Update(func(tx *bbolt.Tx) error {
-		if tx.Bucket([]byte(name)) != nil {
-			return kvstore.NewErrAlreadyExists(name)
+func (db *KeyValueDB) CreateList(path kvstore.ListPath) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		parent, err := findParentBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		if parent.Bucket([]byte(path.Name())) != nil {
+			return kvstore.NewErrAlreadyExists(path.String())
 		}
-		_, err := tx.CreateBucket([]byte(name))
+		_, err = parent.CreateBucket([]byte(path.Name()))
 		return err
 	})
 }
 
-func (db *KeyValueDB) DeleteList(name string) error {
-	return db.f.Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket([]byte(name))
+func (db *KeyValueDB) DeleteList(path kvstore.ListPath) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		parent, err := findParentBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		if parent.Bucket([]byte(path.Name())) == nil {
+			return kvstore.NewErrNotFound(path.String())
+		}
+		return parent.DeleteBucket([]byte(path.Name()))
+	})
+}
+
+func (db *KeyValueDB) RenameList(path, newPath kvstore.ListPath) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		err := copyList(tx, path, newPath)
+		if err != nil {
+			return err
+		}
+		parent, err := findParentBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		return parent.DeleteBucket([]byte(path.Name()))
+	})
+}
+
+func (db *KeyValueDB) CopyList(path, newPath kvstore.ListPath) error {
+	return db.update(func(tx *bbolt.Tx) error { return copyList(tx, path, newPath) })
+}
+
+// Creates the bucket at newPath with the content of the bucket at path.
+func copyList(tx *bbolt.Tx, path, newPath kvstore.ListPath) error {
+	if path.Contains(newPath) {
+		return fmt.Errorf("can't copy bucket %q into itself", path.String())
+	}
+	src, err := findBucket(tx, path)
+	if err != nil {
+		return err
+	}
+	parent, err := findParentBucket(tx, newPath)
+	if err != nil {
+		return err
+	}
+	if parent.Bucket([]byte(newPath.Name())) != nil {
+		return kvstore.NewErrAlreadyExists(newPath.String())
+	}
+	dst, err := parent.CreateBucket([]byte(newPath.Name()))
+	if err != nil {
+		return err
+	}
+	return copyBucket(src, dst)
+}
+
+// Copies the rows, nested buckets and sequence of src into dst.
+func copyBucket(src, dst *bbolt.Bucket) error {
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(src.Bucket(k), nested)
 	})
 }
 
-func (db *KeyValueDB) ReadEachList(callback func(string) error) error {
-	return db.f.View(func(tx *bbolt.Tx) error {
-		return tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
-			return callback(string(name))
+func (db *KeyValueDB) ReadEachList(callback func(kvstore.ListPath) error) error {
+	return db.view(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			return readEachNestedBucket(b, kvstore.ListPath{string(name)}, callback)
 		})
 	})
 }
 
-func (db *KeyValueDB) CreateRow(list string, row *kvstore.Row) error {
-	return db.f.Update(func(tx *bbolt.Tx) error {
-		b, err := findBucket(tx, []byte(list))
+// Calls the callback for the given bucket and then recursively for each of its nested buckets.
+func readEachNestedBucket(b *bbolt.Bucket, path kvstore.ListPath, callback func(kvstore.ListPath) error) error {
+	err := callback(path)
+	if err != nil {
+		return err
+	}
+	return b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil // not a bucket
+		}
+		return readEachNestedBucket(b.Bucket(k), path.Child(string(k)), callback)
+	})
+}
+
+func (db *KeyValueDB) CreateRow(list kvstore.ListPath, row *kvstore.Row) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
 		if err != nil {
 			return err
 		}
@@ -102,36 +293,34 @@ func (db *KeyValueDB) CreateRow(list string, row *kvstore.Row) error {
 	})
 }
 
-func (db *KeyValueDB) ReadRow(list string, key string) (*kvstore.Row, error) {
-	out := &kvstore.Row{Key: []byte(key)}
-	return out, db.f.View(func(tx *bbolt.Tx) error {
-		_, v, err := findBucketRow(tx, []byte(list), []byte(key))
+func (db *KeyValueDB) ReadRow(list kvstore.ListPath, key kvstore.RowKey) (*kvstore.Row, error) {
+	out := &kvstore.Row{Key: key}
+	return out, db.view(func(tx *bbolt.Tx) error {
+		_, v, err := findBucketRow(tx, list, key)
 		if err != nil {
 			return err
 		}
-		out.Value = v
+		out.Value = copyBytes(v)
 		return nil
 	})
 }
 
-func (db *KeyValueDB) ReadRowPage(list string, pageIndex, numRowsPerPage int) ([]*kvstore.Row, error) {
+func (db *KeyValueDB) ReadRowPage(list kvstore.ListPath, pageIndex, numRowsPerPage int) ([]*kvstore.Row, error) {
 	var out []*kvstore.Row
-	return out, db.f.View(func(tx *bbolt.Tx) error {
-		b, err := findBucket(tx, []byte(list))
+	return out, db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
 		if err != nil {
 			return err
 		}
 		offset := pageIndex * numRowsPerPage
 		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			for i := 0; i < offset; i++ {
-				k, v = c.Next()
-				if k == nil {
-					break
-				}
+		for k, v := c.First(); k != nil && len(out) < numRowsPerPage; k, v = c.Next() {
+			if v == nil {
+				continue // skip nested buckets
 			}
-			if len(out) == numRowsPerPage {
-				break
+			if offset > 0 {
+				offset--
+				continue
 			}
 			out = append(out, &kvstore.Row{Key: k, Value: v})
 		}
@@ -139,53 +328,194 @@ func (db *KeyValueDB) ReadRowPage(list string, pageIndex, numRowsPerPage int) ([
 	})
 }
 
-func (db *KeyValueDB) ReadEachRow(list string, callback func(*kvstore.Row) error) error {
-	return db.f.View(func(tx *bbolt.Tx) error {
-		b, err := findBucket(tx, []byte(list))
+func (db *KeyValueDB) ReadEachRow(list kvstore.ListPath, callback func(*kvstore.Row) error) error {
+	return db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
 		if err != nil {
 			return err
 		}
 		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil // skip nested buckets
+			}
 			return callback(&kvstore.Row{Key: k, Value: v})
 		})
 	})
 }
 
-func (db *KeyValueDB) UpdateRow(list string, key string, newValue string) error {
-	return db.f.Update(func(tx *bbolt.Tx) error {
-		b, _, err := findBucketRow(tx, []byte(list), []byte(key))
+func (db *KeyValueDB) UpdateRow(list kvstore.ListPath, key kvstore.RowKey, newValue kvstore.RowValue) error {
+	return db.update(func(tx *bbolt.Tx) error { return updateRow(tx, list, key, newValue) })
+}
+
+func (db *KeyValueDB) PutRow(list kvstore.ListPath, row *kvstore.Row) (bool, error) {
+	created := false
+	err := db.update(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, list)
 		if err != nil {
 			return err
 		}
-		return b.Put([]byte(key), []byte(newValue))
+		created = b.Get(row.Key) == nil
+		return b.Put(row.Key, row.Value)
 	})
+	return created, err
+}
+
+// Replaces the value of an existing row.
+func updateRow(tx *bbolt.Tx, list kvstore.ListPath, key kvstore.RowKey, newValue kvstore.RowValue) error {
+	b, _, err := findBucketRow(tx, list, key)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, newValue)
+}
+
+func (db *KeyValueDB) MoveRow(list kvstore.ListPath, key kvstore.RowKey, newList kvstore.ListPath, newKey kvstore.RowKey) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		b, err := copyRow(tx, list, key, newList, newKey)
+		if err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+}
+
+func (db *KeyValueDB) CopyRow(list kvstore.ListPath, key kvstore.RowKey, newList kvstore.ListPath, newKey kvstore.RowKey) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		_, err := copyRow(tx, list, key, newList, newKey)
+		return err
+	})
+}
+
+// Writes the value of an existing row under a new key (that must not exist yet), returns the source bucket.
+func copyRow(tx *bbolt.Tx, list kvstore.ListPath, key kvstore.RowKey, newList kvstore.ListPath, newKey kvstore.RowKey) (*bbolt.Bucket, error) {
+	b, v, err := findBucketRow(tx, list, key)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := findBucket(tx, newList)
+	if err != nil {
+		return nil, err
+	}
+	if dst.Get(newKey) != nil || dst.Bucket(newKey) != nil {
+		return nil, kvstore.NewErrAlreadyExists(string(newKey))
+	}
+	return b, dst.Put(newKey, copyBytes(v))
 }
-func (db *KeyValueDB) DeleteRow(list string, key string) error {
-	return db.f.Update(func(tx *bbolt.Tx) error {
-		b, _, err := findBucketRow(tx, []byte(list), []byte(key))
+
+func (db *KeyValueDB) DeleteRow(list kvstore.ListPath, key kvstore.RowKey) error {
+	return db.update(func(tx *bbolt.Tx) error {
+		b, _, err := findBucketRow(tx, list, key)
 		if err != nil {
 			return err
 		}
-		return b.Delete([]byte(key))
+		return b.Delete(key)
 	})
 }
 
-func findBucket(tx *bbolt.Tx, name []byte) (*bbolt.Bucket, error) {
-	b := tx.Bucket(name)
+// bucketContainer is implemented by both *bbolt.Tx (root) and *bbolt.Bucket.
+type bucketContainer interface {
+	Bucket(name []byte) *bbolt.Bucket
+	CreateBucket(name []byte) (*bbolt.Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+func findBucket(tx *bbolt.Tx, path kvstore.ListPath) (*bbolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty bucket path")
+	}
+	parent, err := findParentBucket(tx, path)
+	if err != nil {
+		return nil, err
+	}
+	b := parent.Bucket([]byte(path.Name()))
 	if b == nil {
-		return nil, kvstore.NewErrNotFound(string(name))
+		return nil, kvstore.NewErrNotFound(path.String())
 	}
 	return b, nil
 }
 
-func findBucketRow(tx *bbolt.Tx, bucketName, key []byte) (*bbolt.Bucket, []byte, error) {
+// Returns the bucket containing the last bucket of the path (or the transaction for top-level buckets).
+func findParentBucket(tx *bbolt.Tx, path kvstore.ListPath) (bucketContainer, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty bucket path")
+	}
+	if len(path) == 1 {
+		return tx, nil
+	}
+	return findBucket(tx, path[:len(path)-1])
+}
+
+func findBucketRow(tx *bbolt.Tx, bucketName kvstore.ListPath, key []byte) (*bbolt.Bucket, []byte, error) {
 	b, err := findBucket(tx, bucketName)
 	if err != nil {
 		return nil, nil, err
 	}
-	v := b.Get([]byte(key))
+	v := b.Get(key)
 	if v == nil {
 		return b, nil, kvstore.NewErrNotFound(string(key))
 	}
 	return b, v, nil
 }
+
+func (db *KeyValueDB) PutRows(rows []*kvstore.ListRow, onConflict kvstore.ConflictPolicy, dryRun bool) (*kvstore.WriteReport, error) {
+	report := &kvstore.WriteReport{}
+	return report, db.updateOrDryRun(dryRun, func(tx *bbolt.Tx) error {
+		buckets := map[string]*bbolt.Bucket{} // cache buckets by encoded path
+		for _, lr := range rows {
+			b, ok := buckets[lr.List.String()]
+			if !ok {
+				var err error
+				b, err = createBucketPath(tx, lr.List, report)
+				if err != nil {
+					return err
+				}
+				buckets[lr.List.String()] = b
+			}
+			err := putRow(b, lr.Row, onConflict, report)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Writes a row according to the conflict policy and updates the report.
+func putRow(b *bbolt.Bucket, row *kvstore.Row, onConflict kvstore.ConflictPolicy, report *kvstore.WriteReport) error {
+	if b.Get(row.Key) != nil {
+		switch onConflict {
+		case kvstore.ConflictSkip:
+			report.Skipped++
+			return nil
+		case kvstore.ConflictOverwrite:
+			report.Updated++
+			return b.Put(row.Key, row.Value)
+		default:
+			return kvstore.NewErrAlreadyExists(string(row.Key))
+		}
+	}
+	report.Created++
+	return b.Put(row.Key, row.Value)
+}
+
+// Returns the bucket at the given path, creating it (and its parents) if needed.
+func createBucketPath(tx *bbolt.Tx, path kvstore.ListPath, report *kvstore.WriteReport) (*bbolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty bucket path")
+	}
+	var parent bucketContainer = tx
+	var b *bbolt.Bucket
+	for _, name := range path {
+		b = parent.Bucket([]byte(name))
+		if b == nil {
+			var err error
+			b, err = parent.CreateBucket([]byte(name))
+			if err != nil {
+				return nil, err
+			}
+			report.ListsCreated++
+		}
+		parent = b
+	}
+	return b, nil
+}
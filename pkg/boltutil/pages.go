@@ -0,0 +1,301 @@
+package boltutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+// Layout of bbolt pages (see go.etcd.io/bbolt/page.go).
+// Pages are stored using the host byte order (see pageByteOrder).
+const (
+	pageHeaderSize      = 16 // id (8), flags (2), count (2), overflow (4)
+	pageElementSize     = 16 // branch: pos, ksize, pgid (8) / leaf: flags, pos, ksize, vsize
+	metaSize            = 64 // magic, version, page size, flags, root bucket (16), freelist, pgid, txid, checksum
+	bucketHeaderSize    = 16 // root (8), sequence (8)
+	branchPageFlag      = 0x01
+	bucketLeafFlag      = 0x01
+	freelistCountMarker = 0xFFFF // the actual count is stored in the first element when reached
+)
+
+var errInvalidPage = errors.New("invalid page")
+
+// Raw page data (including overflow pages).
+type rawPage []byte
+
+func (p rawPage) flags() uint16 { return pageByteOrder.Uint16(p[8:]) }
+func (p rawPage) count() int    { return int(pageByteOrder.Uint16(p[10:])) }
+func (p rawPage) overflow() int { return int(pageByteOrder.Uint32(p[12:])) }
+
+// Returns the data of the i-th element (key and value), checking bounds since the file may be corrupted.
+func (p rawPage) element(i int) (flags uint32, key, value []byte, child uint64, err error) {
+	off := pageHeaderSize + i*pageElementSize
+	if off+pageElementSize > len(p) {
+		return 0, nil, nil, 0, errInvalidPage
+	}
+	elem := p[off : off+pageElementSize]
+	if p.flags()&branchPageFlag != 0 {
+		pos := off + int(pageByteOrder.Uint32(elem[0:]))
+		ksize := int(pageByteOrder.Uint32(elem[4:]))
+		if pos+ksize > len(p) {
+			return 0, nil, nil, 0, errInvalidPage
+		}
+		return 0, p[pos : pos+ksize], nil, pageByteOrder.Uint64(elem[8:]), nil
+	}
+	flags = pageByteOrder.Uint32(elem[0:])
+	pos := off + int(pageByteOrder.Uint32(elem[4:]))
+	ksize := int(pageByteOrder.Uint32(elem[8:]))
+	vsize := int(pageByteOrder.Uint32(elem[12:]))
+	if pos+ksize+vsize > len(p) {
+		return 0, nil, nil, 0, errInvalidPage
+	}
+	return flags, p[pos : pos+ksize], p[pos+ksize : pos+ksize+vsize], 0, nil
+}
+
+// Returns the number of bytes used by the header and elements.
+func (p rawPage) usedSize(typ string) int {
+	switch typ {
+	case kvstore.PageTypeMeta:
+		return pageHeaderSize + metaSize
+	case kvstore.PageTypeFreelist:
+		n := p.count()
+		if n == freelistCountMarker && len(p) >= pageHeaderSize+8 {
+			return pageHeaderSize + 8 + int(pageByteOrder.Uint64(p[pageHeaderSize:]))*8
+		}
+		return pageHeaderSize + n*8
+	case kvstore.PageTypeBranch, kvstore.PageTypeLeaf:
+		used := pageHeaderSize + p.count()*pageElementSize
+		for i := 0; i < p.count(); i++ {
+			_, key, value, _, err := p.element(i)
+			if err != nil {
+				break
+			}
+			used += len(key) + len(value)
+		}
+		return used
+	}
+	return 0
+}
+
+// Reads raw pages from the DB file.
+// This is safe as long as it's done within a read transaction that can reach the pages,
+// since bbolt doesn't overwrite pages that are still in use.
+type pageReader struct {
+	f        *os.File
+	pageSize int
+	numPages uint64             // high water mark of the transaction, pages can't extend past it
+	onRead   func(numPages int) // called after each read with the number of pages read (including overflow), may be nil
+	onError  func(err error)    // if set, walk errors are passed to it and the walk continues with the next page
+}
+
+// Reads a page and its overflow pages, the page ID and overflow count are checked against the high water mark
+// since they may come from a corrupted file.
+func (pr *pageReader) read(id uint64) (rawPage, error) {
+	if id >= pr.numPages {
+		return nil, fmt.Errorf("read page %d: %w (out of range)", id, errInvalidPage)
+	}
+	p := make(rawPage, pr.pageSize)
+	_, err := pr.f.ReadAt(p, int64(id)*int64(pr.pageSize))
+	if err != nil {
+		return nil, fmt.Errorf("read page %d: %w", id, err)
+	}
+	if overflow := p.overflow(); overflow > 0 {
+		if uint64(overflow) >= pr.numPages-id {
+			return nil, fmt.Errorf("read page %d: %w (%d overflow pages out of range)", id, errInvalidPage, overflow)
+		}
+		p = append(p, make([]byte, overflow*pr.pageSize)...)
+		_, err = pr.f.ReadAt(p[pr.pageSize:], int64(id+1)*int64(pr.pageSize))
+		if err != nil {
+			return nil, fmt.Errorf("read page %d: %w", id, err)
+		}
+	}
+	if pr.onRead != nil {
+		pr.onRead(1 + p.overflow())
+	}
+	return p, nil
+}
+
+// Returns the list owning each branch and leaf page, by walking the B+tree of each list from its root in tx.
+// Pages of the top-level tree (storing top-level lists) aren't mapped since bbolt doesn't expose its root.
+func (pr *pageReader) walkOwners(tx *bbolt.Tx) (map[uint64]kvstore.ListPath, error) {
+	out := map[uint64]kvstore.ListPath{}
+	return out, tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		if b.Root() == 0 {
+			return nil // inline bucket, stored in the top-level tree
+		}
+		return pr.walkTree(uint64(b.Root()), kvstore.ListPath{string(name)}, out, 0)
+	})
+}
+
+// Caches the page owners of the last transaction read, since walking the B+trees reads every branch and leaf page.
+type pageOwnersCache struct {
+	mu     sync.Mutex
+	txID   int
+	owners map[uint64]kvstore.ListPath // shared by all callers, must not be modified
+}
+
+// Returns the page owners for tx (see walkOwners), computed at most once per transaction ID.
+func (db *KeyValueDB) readOwners(tx *bbolt.Tx, pr *pageReader) (map[uint64]kvstore.ListPath, error) {
+	c := &db.pageOwners
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.owners != nil && c.txID == tx.ID() {
+		return c.owners, nil
+	}
+	owners, err := pr.walkOwners(tx)
+	if err != nil {
+		return nil, err
+	}
+	c.txID, c.owners = tx.ID(), owners
+	return owners, nil
+}
+
+// Maps the pages of the tree rooted at page id to owner (see walkOwners).
+func (pr *pageReader) walkTree(id uint64, owner kvstore.ListPath, owners map[uint64]kvstore.ListPath, depth int) error {
+	err := pr.walkPage(id, owner, owners, depth)
+	if err != nil && pr.onError != nil {
+		pr.onError(err)
+		return nil // skip the rest of the subtree
+	}
+	return err
+}
+
+func (pr *pageReader) walkPage(id uint64, owner kvstore.ListPath, owners map[uint64]kvstore.ListPath, depth int) error {
+	if depth > 64 {
+		return fmt.Errorf("page %d: tree is too deep", id)
+	}
+	if _, ok := owners[id]; ok {
+		return fmt.Errorf("page %d: multiple references", id)
+	}
+	owners[id] = owner
+	p, err := pr.read(id)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < p.count(); i++ {
+		flags, key, value, child, err := p.element(i)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", id, err)
+		}
+		switch {
+		case p.flags()&branchPageFlag != 0: // walk child page
+			err = pr.walkTree(child, owner, owners, depth+1)
+		case flags&bucketLeafFlag != 0 && len(value) >= bucketHeaderSize:
+			// Nested bucket, inline buckets (root = 0) are stored in the value and don't have their own pages
+			if childRoot := pageByteOrder.Uint64(value); childRoot != 0 {
+				err = pr.walkTree(childRoot, owner.Child(string(key)), owners, 0)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs fn in a read transaction with a page reader for the DB file.
+func (db *KeyValueDB) viewPages(fn func(tx *bbolt.Tx, pr *pageReader) error) error {
+	return db.view(func(tx *bbolt.Tx) error {
+		f, err := os.Open(db.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		pageSize := db.f.Info().PageSize
+		return fn(tx, &pageReader{f: f, pageSize: pageSize, numPages: uint64(tx.Size() / int64(pageSize))})
+	})
+}
+
+// Returns information about a page (type, overflow and fill ratio), owners may be nil.
+func (pr *pageReader) pageInfo(tx *bbolt.Tx, id uint64, owners map[uint64]kvstore.ListPath) (*kvstore.PageInfo, error) {
+	info, err := tx.Page(int(id))
+	if err != nil {
+		return nil, err
+	} else if info == nil {
+		return nil, kvstore.NewErrNotFound(fmt.Sprintf("page %d", id))
+	}
+	out := &kvstore.PageInfo{ID: id, Type: info.Type, Size: pr.pageSize}
+	if info.Type == kvstore.PageTypeFree {
+		return out, nil // free pages can contain stale data
+	}
+	p, err := pr.read(id)
+	if err != nil {
+		return nil, err
+	}
+	out.Overflow = p.overflow()
+	out.Count = p.count()
+	out.Size = (out.Overflow + 1) * pr.pageSize
+	out.Used = p.usedSize(info.Type)
+	out.List = owners[id]
+	return out, nil
+}
+
+// ReadPageMap returns limit pages of the DB file starting at the given page ID.
+func (db *KeyValueDB) ReadPageMap(offset, limit int) (*kvstore.PageMap, error) {
+	out := &kvstore.PageMap{}
+	return out, db.viewPages(func(tx *bbolt.Tx, pr *pageReader) error {
+		out.PageSize = pr.pageSize
+		out.NumPages = int(tx.Size() / int64(pr.pageSize))
+		owners, err := db.readOwners(tx, pr)
+		if err != nil {
+			return err
+		}
+		for id := 0; id < out.NumPages && id < offset+limit; {
+			// Skip overflow pages
+			info, err := tx.Page(id)
+			if err != nil {
+				return err
+			}
+			if id+info.OverflowCount < offset {
+				id += 1 + info.OverflowCount
+				continue
+			}
+			page, err := pr.pageInfo(tx, uint64(id), owners)
+			if err != nil {
+				return err
+			}
+			out.Pages = append(out.Pages, page)
+			id += 1 + page.Overflow
+		}
+		return nil
+	})
+}
+
+// ReadPage returns the elements of a branch or leaf page.
+func (db *KeyValueDB) ReadPage(id uint64) (*kvstore.PageContent, error) {
+	out := &kvstore.PageContent{}
+	return out, db.viewPages(func(tx *bbolt.Tx, pr *pageReader) error {
+		owners, err := db.readOwners(tx, pr)
+		if err != nil {
+			return err
+		}
+		out.Page, err = pr.pageInfo(tx, id, owners)
+		if err != nil {
+			return err
+		}
+		if out.Page.Type != kvstore.PageTypeBranch && out.Page.Type != kvstore.PageTypeLeaf {
+			return nil
+		}
+		p, err := pr.read(id)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < p.count(); i++ {
+			flags, key, value, child, err := p.element(i)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", id, err)
+			}
+			out.Elements = append(out.Elements, &kvstore.PageElement{
+				Key:       copyBytes(key),
+				ValueSize: len(value),
+				IsList:    flags&bucketLeafFlag != 0,
+				Child:     child,
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,134 @@
+package boltutil
+
+import (
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+	"go.etcd.io/bbolt"
+)
+
+// ListStats returns the bbolt bucket stats (including nested buckets).
+func (db *KeyValueDB) ListStats(path kvstore.ListPath) (*kvstore.ListStats, error) {
+	var out *kvstore.ListStats
+	return out, db.view(func(tx *bbolt.Tx) error {
+		b, err := findBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		out = newListStats(b.Stats())
+		return nil
+	})
+}
+
+func newListStats(stats bbolt.BucketStats) *kvstore.ListStats {
+	return &kvstore.ListStats{
+		BranchPageN:       stats.BranchPageN,
+		BranchOverflowN:   stats.BranchOverflowN,
+		LeafPageN:         stats.LeafPageN,
+		LeafOverflowN:     stats.LeafOverflowN,
+		KeyN:              stats.KeyN,
+		Depth:             stats.Depth,
+		BranchAlloc:       stats.BranchAlloc,
+		BranchInuse:       stats.BranchInuse,
+		LeafAlloc:         stats.LeafAlloc,
+		LeafInuse:         stats.LeafInuse,
+		BucketN:           stats.BucketN,
+		InlineBucketN:     stats.InlineBucketN,
+		InlineBucketInuse: stats.InlineBucketInuse,
+	}
+}
+
+// ReadListInfos returns the info of all buckets (ordered depth-first) from a single read transaction.
+// Rows are counted and their sizes summed in the same pass over each bucket,
+// or they are estimated from the bucket stats (see kvstore.EstimateListInfo).
+// onProgress (may be nil) is called with the number of buckets done.
+func (db *KeyValueDB) ReadListInfos(estimate bool, onProgress func(done int)) ([]*kvstore.ListInfo, error) {
+	out := []*kvstore.ListInfo{}
+	done := 0
+	onDone := func() {
+		done++
+		if onProgress != nil {
+			onProgress(done)
+		}
+	}
+	err := db.view(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			infos, _, err := readListInfos(b, kvstore.ListPath{string(name)}, estimate, onDone)
+			out = append(out, infos...)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Returns the info of the bucket followed by the info of its nested buckets, and the bucket stats.
+// Nested buckets are read first so their stats can be subtracted from the stats of their parent when estimating.
+func readListInfos(b *bbolt.Bucket, path kvstore.ListPath, estimate bool, onDone func()) ([]*kvstore.ListInfo, *kvstore.ListStats, error) {
+	info := &kvstore.ListInfo{Path: path}
+	nested := []*kvstore.ListInfo{}
+	childStats := map[string]*kvstore.ListStats{}
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			info.NumRows++
+			info.TotalRowSize += uint64(len(k) + len(v))
+			return nil
+		}
+		infos, stats, err := readListInfos(b.Bucket(k), path.Child(string(k)), estimate, onDone)
+		if err != nil {
+			return err
+		}
+		nested = append(nested, infos...)
+		childStats[string(k)] = stats
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := newListStats(b.Stats())
+	if estimate {
+		info = kvstore.EstimateListInfo(path, stats, childStats)
+	} else {
+		info.Stats = stats
+		if info.NumRows != 0 {
+			info.AvgRowSize = info.TotalRowSize / info.NumRows
+		}
+	}
+	onDone()
+	return append([]*kvstore.ListInfo{info}, nested...), stats, nil
+}
+
+// Stats returns the bbolt DB stats.
+func (db *KeyValueDB) Stats() (*kvstore.DBStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.err != nil {
+		return nil, db.err
+	}
+	stats := db.f.Stats()
+	pageSize := db.f.Info().PageSize
+	return &kvstore.DBStats{
+		PageSize:      pageSize,
+		FreePageN:     stats.FreePageN,
+		PendingPageN:  stats.PendingPageN,
+		FreeAlloc:     (stats.FreePageN + stats.PendingPageN) * pageSize,
+		FreelistInuse: stats.FreelistInuse,
+		TxN:           stats.TxN,
+		OpenTxN:       stats.OpenTxN,
+		PageCount:     stats.TxStats.GetPageCount(),
+		PageAlloc:     stats.TxStats.GetPageAlloc(),
+		Rebalance:     stats.TxStats.GetRebalance(),
+		Split:         stats.TxStats.GetSplit(),
+		Spill:         stats.TxStats.GetSpill(),
+		Write:         stats.TxStats.GetWrite(),
+		WriteTime:     stats.TxStats.GetWriteTime(),
+	}, nil
+}
+
+func (db *KeyValueDB) TxID() (int, error) {
+	out := 0
+	return out, db.view(func(tx *bbolt.Tx) error {
+		out = tx.ID()
+		return nil
+	})
+}
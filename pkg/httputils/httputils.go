@@ -36,6 +36,9 @@ func (srec *httpStatusRecorder) WriteHeader(statusCode int) {
 	srec.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap allows http.ResponseController to access the underlying response writer (to flush or extend deadlines).
+func (srec *httpStatusRecorder) Unwrap() http.ResponseWriter { return srec.ResponseWriter }
+
 type PanicHandler func(w http.ResponseWriter, r *http.Request, err any)
 
 // Panic recovery middleware logs the recovered error and executes the onPanic callback function.
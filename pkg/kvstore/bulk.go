@@ -0,0 +1,62 @@
+package kvstore
+
+import "fmt"
+
+// BulkAction is applied to each row matched by a bulk operation.
+type BulkAction string
+
+const (
+	BulkDelete  BulkAction = "delete"
+	BulkCopy    BulkAction = "copy"    // write the row to the target list
+	BulkMove    BulkAction = "move"    // write the row to the target list, then delete it (unless skipped)
+	BulkReplace BulkAction = "replace" // replace regex matches in the value (unchanged rows are skipped)
+)
+
+// BulkActions lists all supported bulk actions.
+var BulkActions = []BulkAction{BulkDelete, BulkCopy, BulkMove, BulkReplace}
+
+// ParseBulkAction returns the bulk action with the given name.
+func ParseBulkAction(s string) (BulkAction, error) {
+	for _, action := range BulkActions {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown bulk action %q", s)
+}
+
+// BulkOperation defines what to do with the rows matched by DB.ApplyToRows.
+type BulkOperation struct {
+	Action     BulkAction
+	Target     ListPath          // for copy and move, created if missing, rows already in it are skipped when moving
+	OnConflict ConflictPolicy    // for copy and move
+	Replace    *ValueReplacement // for replace
+}
+
+// RowMatcher reports whether a row of a list is affected by a bulk operation.
+type RowMatcher func(list ListPath, r *Row) bool
+
+// ListRowSet is a set of rows identified by their list and key.
+type ListRowSet map[string]bool
+
+func listRowSetKey(list ListPath, key RowKey) string { return list.String() + "\x00" + string(key) }
+
+func (set ListRowSet) Add(list ListPath, key RowKey) { set[listRowSetKey(list, key)] = true }
+
+// Match can be used as a RowMatcher.
+func (set ListRowSet) Match(list ListPath, r *Row) bool { return set[listRowSetKey(list, r.Key)] }
+
+// ExportMatches writes every row of the lists (in the key range) accepted by match and closes the row writer,
+// rows are read from a consistent snapshot.
+func ExportMatches(db DB, rw RowWriter, lists []ListPath, keyRange *KeyRange, match RowMatcher) error {
+	err := db.ReadEachRowInLists(lists, keyRange, func(list ListPath, r *Row) error {
+		if !match(list, r) {
+			return nil
+		}
+		return rw.WriteRow(list, r)
+	})
+	if err != nil {
+		return err
+	}
+	return rw.Close()
+}
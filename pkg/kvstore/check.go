@@ -0,0 +1,44 @@
+package kvstore
+
+import "time"
+
+// CheckIssueKind groups integrity issues by cause.
+type CheckIssueKind string
+
+const (
+	CheckIssueUnreachable CheckIssueKind = "unreachable" // page is neither used nor free
+	CheckIssueFreelist    CheckIssueKind = "freelist"    // page is freed twice or used while free
+	CheckIssueKeyOrder    CheckIssueKind = "key_order"   // keys are not sorted
+	CheckIssueOther       CheckIssueKind = "other"
+)
+
+// CheckIssue is an inconsistency found by an integrity check.
+type CheckIssue struct {
+	Kind    CheckIssueKind `json:"kind"`
+	Message string         `json:"message"`
+	PageIDs []uint64       `json:"page_ids"`       // pages the issue refers to (if any)
+	List    ListPath       `json:"list,omitempty"` // list owning the first page, if known (empty for the top-level tree)
+}
+
+// CheckProgress is reported periodically while an integrity check runs.
+// The pages of the B+trees are read first, then bbolt verifies them (which doesn't report progress).
+type CheckProgress struct {
+	PagesRead int           `json:"pages_read"` // branch, leaf and overflow pages of lists read so far
+	NumPages  int           `json:"num_pages"`  // number of pages below the high water mark
+	Verifying bool          `json:"verifying"`  // all pages were read and bbolt is verifying them
+	NumIssues int           `json:"num_issues"` // issues found so far
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+// CheckReport summarizes an integrity check.
+type CheckReport struct {
+	NumPages  int           `json:"num_pages"`  // number of pages below the high water mark
+	PagesRead int           `json:"pages_read"` // branch, leaf and overflow pages of lists
+	NumIssues int           `json:"num_issues"`
+	Duration  time.Duration `json:"duration"`
+	// bbolt's verification was skipped because of pages that can't be read safely (reported as issues)
+	VerifySkipped bool `json:"verify_skipped"`
+}
+
+// OK reports whether no issue was found.
+func (r *CheckReport) OK() bool { return r.NumIssues == 0 }
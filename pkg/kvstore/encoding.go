@@ -0,0 +1,124 @@
+package kvstore
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encoding describes how raw key or value bytes are represented as text.
+type Encoding string
+
+const (
+	EncodingText   Encoding = "text"   // bytes are used as is (UTF-8)
+	EncodingHex    Encoding = "hex"    // hexadecimal string, whitespace is ignored when decoding
+	EncodingBase64 Encoding = "base64" // standard base64 with padding
+	EncodingInt    Encoding = "int"    // decimal representation of a big-endian uint64 (8 bytes)
+)
+
+// Encodings lists all supported encodings (used to render select inputs).
+var Encodings = []Encoding{EncodingText, EncodingHex, EncodingBase64, EncodingInt}
+
+// ParseEncoding returns the encoding with the given name, an empty name defaults to text.
+func ParseEncoding(s string) (Encoding, error) {
+	if s == "" {
+		return EncodingText, nil
+	}
+	for _, enc := range Encodings {
+		if string(enc) == s {
+			return enc, nil
+		}
+	}
+	return "", fmt.Errorf("unknown encoding %q", s)
+}
+
+// Encode returns the text representation of b.
+func (enc Encoding) Encode(b []byte) (string, error) {
+	switch enc {
+	case EncodingText:
+		return string(b), nil
+	case EncodingHex:
+		return hex.EncodeToString(b), nil
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case EncodingInt:
+		if len(b) != 8 {
+			return "", fmt.Errorf("cannot encode %d bytes as a 64-bit integer", len(b))
+		}
+		return strconv.FormatUint(binary.BigEndian.Uint64(b), 10), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q", enc)
+}
+
+// Decode returns the raw bytes represented by s.
+func (enc Encoding) Decode(s string) ([]byte, error) {
+	switch enc {
+	case EncodingText:
+		return []byte(s), nil
+	case EncodingHex:
+		b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, fmt.Errorf("decode hex: %w", err)
+		}
+		return b, nil
+	case EncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("decode base64: %w", err)
+		}
+		return b, nil
+	case EncodingInt:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("decode integer: %w", err)
+		}
+		return binary.BigEndian.AppendUint64(nil, n), nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", enc)
+}
+
+// ParseRowKeyParam decodes a key encoded with RowKey.Param.
+func ParseRowKeyParam(s string) (RowKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	return b, nil
+}
+
+// Param encodes the key so it can safely travel in URLs and forms (URL-safe base64).
+func (k RowKey) Param() string { return base64.RawURLEncoding.EncodeToString(k) }
+
+// IsText reports whether the key is valid UTF-8 without control characters.
+func (k RowKey) IsText() bool { return isText(k) }
+
+// Display returns the key as is if it is text, or a quoted and escaped version otherwise.
+func (k RowKey) Display() string {
+	if isText(k) {
+		return string(k)
+	}
+	return strconv.Quote(string(k))
+}
+
+// IsText reports whether the value is valid UTF-8 without control characters (except whitespace).
+func (v RowValue) IsText() bool { return isText(v) }
+
+// HexDump returns a hex dump of the value (in the same format as "hexdump -C").
+func (v RowValue) HexDump() string { return hex.Dump(v) }
+
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
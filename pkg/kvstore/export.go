@@ -0,0 +1,219 @@
+package kvstore
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportFormat is a file format used to export (and import) rows.
+type ExportFormat string
+
+const (
+	ExportFormatNDJSON ExportFormat = "ndjson" // one JSON object per row and per line
+	ExportFormatJSON   ExportFormat = "json"   // a JSON object mapping keys to values (grouped by list when needed)
+	ExportFormatCSV    ExportFormat = "csv"    // a CSV file with a header line
+)
+
+// ExportFormats lists all supported export formats.
+var ExportFormats = []ExportFormat{ExportFormatNDJSON, ExportFormatJSON, ExportFormatCSV}
+
+// ParseExportFormat returns the export format with the given name, an empty name defaults to NDJSON.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	if s == "" {
+		return ExportFormatNDJSON, nil
+	}
+	for _, format := range ExportFormats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown export format %q", s)
+}
+
+// ContentType returns the MIME type of the format.
+func (format ExportFormat) ContentType() string {
+	switch format {
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case ExportFormatJSON:
+		return "application/json"
+	case ExportFormatCSV:
+		return "text/csv"
+	}
+	return "application/octet-stream"
+}
+
+// ExportRecord is the representation of a row in NDJSON and CSV exports.
+// The list is only set when the export contains rows from multiple lists.
+type ExportRecord struct {
+	List  string `json:"bucket,omitempty"` // encoded list path
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RowWriter writes rows to an export file.
+type RowWriter interface {
+	WriteRow(list ListPath, row *Row) error
+	Close() error // flushes remaining data, the underlying writer is not closed
+}
+
+// NewRowWriter returns a row writer for the given format.
+// Keys and values are encoded with enc,
+// and the list of each row is included when withList is true (used to export multiple lists in a single file).
+func NewRowWriter(w io.Writer, format ExportFormat, enc Encoding, withList bool) (RowWriter, error) {
+	switch format {
+	case ExportFormatNDJSON:
+		return &ndjsonRowWriter{w: bufio.NewWriter(w), enc: enc, withList: withList}, nil
+	case ExportFormatJSON:
+		return &jsonRowWriter{w: bufio.NewWriter(w), enc: enc, withList: withList}, nil
+	case ExportFormatCSV:
+		return &csvRowWriter{w: csv.NewWriter(w), enc: enc, withList: withList}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// Export writes every row of the given lists (from a consistent snapshot) and closes the row writer.
+func Export(db DB, rw RowWriter, lists []ListPath) error {
+	err := db.ReadEachRowInLists(lists, &KeyRange{}, rw.WriteRow)
+	if err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+func encodeExportRecord(enc Encoding, list ListPath, row *Row, withList bool) (*ExportRecord, error) {
+	var err error
+	out := &ExportRecord{}
+	if withList {
+		out.List = list.String()
+	}
+	out.Key, err = enc.Encode(row.Key)
+	if err != nil {
+		return nil, err
+	}
+	out.Value, err = enc.Encode(row.Value)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type ndjsonRowWriter struct {
+	w        *bufio.Writer
+	enc      Encoding
+	withList bool
+}
+
+func (rw *ndjsonRowWriter) WriteRow(list ListPath, row *Row) error {
+	record, err := encodeExportRecord(rw.enc, list, row, rw.withList)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(rw.w).Encode(record) // adds trailing newline
+}
+
+func (rw *ndjsonRowWriter) Close() error { return rw.w.Flush() }
+
+// Writes {"key": "value", ...} or {"list": {"key": "value", ...}, ...} when withList is true.
+// Rows of the same list are expected to be written consecutively.
+type jsonRowWriter struct {
+	w           *bufio.Writer
+	enc         Encoding
+	withList    bool
+	started     bool   // true once the opening brace has been written
+	currentList string // list whose object is currently open (if withList)
+	numRows     int    // number of rows written in the current object
+}
+
+func (rw *jsonRowWriter) WriteRow(list ListPath, row *Row) error {
+	record, err := encodeExportRecord(rw.enc, list, row, rw.withList)
+	if err != nil {
+		return err
+	}
+	if !rw.started {
+		rw.started = true
+		rw.w.WriteString("{")
+	}
+	if rw.withList && (rw.numRows == 0 || record.List != rw.currentList) {
+		if rw.numRows > 0 {
+			rw.w.WriteString("},")
+		}
+		rw.currentList = record.List
+		rw.numRows = 0
+		writeJSONString(rw.w, record.List)
+		rw.w.WriteString(":{")
+	}
+	if rw.numRows > 0 {
+		rw.w.WriteString(",")
+	}
+	rw.numRows++
+	writeJSONString(rw.w, record.Key)
+	rw.w.WriteString(":")
+	return writeJSONString(rw.w, record.Value)
+}
+
+func (rw *jsonRowWriter) Close() error {
+	if !rw.started {
+		rw.w.WriteString("{")
+	}
+	if rw.withList && rw.numRows > 0 {
+		rw.w.WriteString("}")
+	}
+	rw.w.WriteString("}\n")
+	return rw.w.Flush()
+}
+
+func writeJSONString(w io.Writer, s string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+type csvRowWriter struct {
+	w             *csv.Writer
+	enc           Encoding
+	withList      bool
+	headerWritten bool
+}
+
+func (rw *csvRowWriter) writeHeader() error {
+	rw.headerWritten = true
+	if rw.withList {
+		return rw.w.Write([]string{"bucket", "key", "value"})
+	}
+	return rw.w.Write([]string{"key", "value"})
+}
+
+func (rw *csvRowWriter) WriteRow(list ListPath, row *Row) error {
+	if !rw.headerWritten {
+		err := rw.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	record, err := encodeExportRecord(rw.enc, list, row, rw.withList)
+	if err != nil {
+		return err
+	}
+	if rw.withList {
+		return rw.w.Write([]string{record.List, record.Key, record.Value})
+	}
+	return rw.w.Write([]string{record.Key, record.Value})
+}
+
+func (rw *csvRowWriter) Close() error {
+	if !rw.headerWritten {
+		err := rw.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	rw.w.Flush()
+	return rw.w.Error()
+}
@@ -0,0 +1,489 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a compiled filter expression, used to select rows in searches.
+//
+// An expression is made of terms combined with AND (or juxtaposition), OR, NOT and parentheses,
+// for example: key:^user/ value~"active" size>1024 json.status="failed".
+//
+// Terms compare a field to a value (quoted if it contains spaces or parentheses):
+//   - key, value: ":" (regex match), "~" (contains), "=", "!=", "<", "<=", ">", ">=" (byte-wise comparison)
+//   - size, keysize, valuesize: "=", "!=", "<", "<=", ">", ">=" (the value can use a kb, mb or gb suffix)
+//   - json.<path>: ":", "~" (contains, or has an element equal to the value for arrays),
+//     "=", "!=", "<", "<=", ">", ">=" (numeric comparison if both sides are numbers),
+//     or no operator to check that the field exists (the row value is decoded as JSON, see ParseJSONPath)
+//
+// "==" can be used instead of "=".
+type Filter struct {
+	src  string
+	root filterNode
+}
+
+// FilterSyntaxError reports an invalid filter expression.
+type FilterSyntaxError struct {
+	Pos int // byte offset in the expression
+	Msg string
+}
+
+func (err *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("%s (at position %d)", err.Msg, err.Pos+1)
+}
+
+// ParseFilter compiles a filter expression, errors are of type *FilterSyntaxError.
+func ParseFilter(src string) (*Filter, error) {
+	p := &filterParser{src: src}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("empty filter")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+	}
+	return &Filter{src: src, root: root}, nil
+}
+
+// Match reports whether the row matches the filter.
+func (f *Filter) Match(r *Row) bool { return f.root.match(&filterRow{row: r}) }
+
+func (f *Filter) String() string { return f.src }
+
+// Row being matched, the JSON value is decoded at most once.
+type filterRow struct {
+	row         *Row
+	jsonDecoded bool
+	json        any // nil if the value is not valid JSON
+}
+
+func (fr *filterRow) jsonValue() any {
+	if !fr.jsonDecoded {
+		fr.jsonDecoded = true
+		fr.json, _ = decodeJSONValue(fr.row.Value)
+	}
+	return fr.json
+}
+
+type filterNode interface {
+	match(fr *filterRow) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+type filterOr struct{ left, right filterNode }
+type filterNot struct{ node filterNode }
+
+func (n *filterAnd) match(fr *filterRow) bool { return n.left.match(fr) && n.right.match(fr) }
+func (n *filterOr) match(fr *filterRow) bool  { return n.left.match(fr) || n.right.match(fr) }
+func (n *filterNot) match(fr *filterRow) bool { return !n.node.match(fr) }
+
+// Recursive descent parser:
+//
+//	or      = and { "OR" and }
+//	and     = not { ["AND"] not }
+//	not     = "NOT" not | primary
+//	primary = "(" or ")" | term
+//	term    = field operator value
+type filterParser struct {
+	src string
+	pos int
+}
+
+func (p *filterParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return &FilterSyntaxError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *filterParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// Consumes the given keyword (case-insensitive) if it is the next word.
+func (p *filterParser) keyword(kw string) bool {
+	end := p.pos + len(kw)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.pos:end], kw) {
+		return false
+	}
+	if end < len(p.src) && !unicode.IsSpace(rune(p.src[end])) && p.src[end] != '(' {
+		return false // keyword is the beginning of a field name
+	}
+	p.pos = end
+	return true
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.keyword("OR") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		start := p.pos
+		if p.eof() || p.src[p.pos] == ')' || p.keyword("OR") {
+			p.pos = start
+			return left, nil
+		}
+		p.keyword("AND") // optional
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	p.skipSpace()
+	if p.keyword("NOT") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("expected a term")
+	}
+	if p.src[p.pos] != '(' {
+		return p.parseTerm()
+	}
+	p.pos++
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != ')' {
+		return nil, p.errorf("expected \")\"")
+	}
+	p.pos++
+	return node, nil
+}
+
+// Operators, longest first.
+var filterOperators = []string{"==", "!=", "<=", ">=", ":", "~", "=", "<", ">"}
+
+func isFilterFieldChar(c byte) bool {
+	return c == '.' || c == '_' || c == '-' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *filterParser) parseTerm() (filterNode, error) {
+	// Field
+	start := p.pos
+	for !p.eof() && isFilterFieldChar(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a field name")
+	}
+	if !p.eof() && p.src[p.pos] == '[' {
+		return nil, p.errorf("array indexes are path segments (e.g. json.items.0), brackets are not supported")
+	}
+	field := p.src[start:p.pos]
+	term, err := newFilterTerm(field)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("%s", err)
+	}
+
+	// Operator (optionally surrounded by spaces)
+	fieldEnd := p.pos
+	p.skipSpace()
+	opPos := p.pos
+	for _, op := range filterOperators {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			term.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if term.op == "" {
+		if term.field == "json" {
+			p.pos = fieldEnd // existence check
+			return term, nil
+		}
+		return nil, p.errorf("expected an operator after %q", field)
+	}
+	if term.op == "==" {
+		term.op = "="
+	}
+
+	// Value
+	p.skipSpace()
+	valuePos := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	err = term.compile(value)
+	if termErr, ok := err.(*filterTermError); ok {
+		if termErr.operator {
+			p.pos = opPos
+		} else {
+			p.pos = valuePos
+		}
+		return nil, p.errorf("%s", termErr.msg)
+	}
+	return term, nil
+}
+
+// Parses a quoted string or a bare word (ending at a space or a closing parenthesis).
+func (p *filterParser) parseValue() (string, error) {
+	if p.eof() || unicode.IsSpace(rune(p.src[p.pos])) {
+		return "", p.errorf("expected a value")
+	}
+	start := p.pos
+	if p.src[p.pos] != '"' {
+		for !p.eof() && !unicode.IsSpace(rune(p.src[p.pos])) && p.src[p.pos] != ')' {
+			p.pos++
+		}
+		if p.pos == start {
+			return "", p.errorf("expected a value")
+		}
+		return p.src[start:p.pos], nil
+	}
+	for p.pos++; !p.eof(); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++ // skip escaped character
+		case '"':
+			p.pos++
+			value, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				p.pos = start
+				return "", p.errorf("invalid quoted string")
+			}
+			return value, nil
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated quoted string")
+}
+
+// A single comparison between a row field and a value.
+type filterTerm struct {
+	field    string
+	jsonPath JSONPath // for JSON fields
+	op       string   // empty for JSON existence checks
+	value    string
+	regex    *regexp.Regexp // for ":"
+	number   int64          // for size fields
+}
+
+type filterTermError struct {
+	msg      string
+	operator bool // the error is caused by the operator (otherwise by the value)
+}
+
+func (err *filterTermError) Error() string { return err.msg }
+
+func newFilterTerm(field string) (*filterTerm, error) {
+	switch {
+	case field == "key", field == "value", field == "size", field == "keysize", field == "valuesize":
+		return &filterTerm{field: field}, nil
+	case strings.HasPrefix(field, "json."):
+		path, err := ParseJSONPath(strings.TrimPrefix(field, "json."))
+		if err != nil {
+			return nil, err
+		}
+		return &filterTerm{field: "json", jsonPath: path}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q (expected key, value, size, keysize, valuesize or json.<path>)", field)
+}
+
+func (t *filterTerm) compile(value string) error {
+	t.value = value
+	var allowedOps string
+	switch t.field {
+	case "key", "value", "json":
+		allowedOps = ": ~ = != < <= > >="
+		if t.op == ":" {
+			var err error
+			t.regex, err = regexp.Compile(value)
+			if err != nil {
+				return &filterTermError{msg: fmt.Sprintf("invalid regex: %s", err)}
+			}
+		}
+	case "size", "keysize", "valuesize":
+		allowedOps = "= != < <= > >="
+		var err error
+		t.number, err = ParseByteSize(value)
+		if err != nil {
+			return &filterTermError{msg: err.Error()}
+		}
+	}
+	for _, op := range strings.Fields(allowedOps) {
+		if op == t.op {
+			return nil
+		}
+	}
+	return &filterTermError{msg: fmt.Sprintf("operator %q can't be used with %s (expected %s)", t.op, t.field, allowedOps), operator: true}
+}
+
+func (t *filterTerm) match(fr *filterRow) bool {
+	switch t.field {
+	case "key":
+		return t.matchBytes(fr.row.Key)
+	case "value":
+		return t.matchBytes(fr.row.Value)
+	case "size":
+		return compareWithOp(t.op, compareInts(int64(fr.row.Size()), t.number))
+	case "keysize":
+		return compareWithOp(t.op, compareInts(int64(len(fr.row.Key)), t.number))
+	case "valuesize":
+		return compareWithOp(t.op, compareInts(int64(len(fr.row.Value)), t.number))
+	case "json":
+		v, ok := t.jsonPath.Lookup(fr.jsonValue())
+		if !ok || t.op == "" {
+			return ok
+		}
+		return t.matchJSON(v)
+	}
+	return false
+}
+
+func (t *filterTerm) matchJSON(v any) bool {
+	switch t.op {
+	case ":", "~":
+		if elems, ok := v.([]any); ok {
+			for _, elem := range elems {
+				if t.matchJSONString(JSONValueString(elem), true) {
+					return true
+				}
+			}
+			return false
+		}
+		return t.matchJSONString(JSONValueString(v), false)
+	}
+	return compareWithOp(t.op, compareJSONValue(v, t.value))
+}
+
+// Matches a string with ":" or "~", array elements must be equal to the value for "~".
+func (t *filterTerm) matchJSONString(s string, isElem bool) bool {
+	if t.op == ":" {
+		return t.regex.MatchString(s)
+	}
+	if isElem {
+		return s == t.value
+	}
+	return strings.Contains(s, t.value)
+}
+
+func (t *filterTerm) matchBytes(b []byte) bool {
+	switch t.op {
+	case ":":
+		return t.regex.Match(b)
+	case "~":
+		return bytes.Contains(b, []byte(t.value))
+	}
+	return compareWithOp(t.op, bytes.Compare(b, []byte(t.value)))
+}
+
+// Reports whether the result of a comparison (-1, 0 or 1) satisfies the operator.
+func compareWithOp(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compares a decoded JSON value to a filter value, numerically if both are numbers.
+func compareJSONValue(v any, s string) int {
+	if n, ok := v.(json.Number); ok {
+		a, errA := strconv.ParseFloat(n.String(), 64)
+		b, errB := strconv.ParseFloat(s, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(JSONValueString(v), s)
+}
+
+// ParseByteSize parses a number of bytes with an optional unit (b, kb, mb or gb, in powers of 1024).
+func ParseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}, {"b", 1}}
+	lower := strings.ToLower(s)
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, factor = strings.TrimSuffix(lower, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	} else if n > math.MaxInt64/factor {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * factor, nil
+}
@@ -0,0 +1,73 @@
+package kvstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"", 0, "empty filter"},
+		{"   ", 3, "empty filter"},
+		{"key:", 4, "expected a value"},
+		{"key:^a (", 8, "expected a term"},
+		{"key:^a )", 7, `unexpected ")"`},
+		{"(key:a", 6, `expected ")"`},
+		{"NOT", 3, "expected a term"},
+		{"key:a OR", 8, "expected a term"},
+		{"foo=1", 0, `unknown field "foo" (expected key, value, size, keysize, valuesize or json.<path>)`},
+		{"json.a=1 x", 9, `unknown field "x" (expected key, value, size, keysize, valuesize or json.<path>)`},
+		{"json.", 0, "empty JSON path"},
+		{"json..a", 0, `empty segment in JSON path ".a"`},
+		{"json.items[0]=1", 10, "array indexes are path segments (e.g. json.items.0), brackets are not supported"},
+		{"size~1", 4, `operator "~" can't be used with size (expected = != < <= > >=)`},
+		{"size>abc", 5, `invalid size "abc"`},
+		{"size>99999999999gb", 5, `size "99999999999gb" is too large`},
+		{`key:"abc`, 4, "unterminated quoted string"},
+		{"key:[", 4, "invalid regex: error parsing regexp: missing closing ]: `[`"},
+		{`value~"a b" OR NOT (size<1kb`, 28, `expected ")"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseFilter(tt.src)
+		var syntaxErr *FilterSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseFilter(%q): got error %v, want a *FilterSyntaxError", tt.src, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || syntaxErr.Msg != tt.msg {
+			t.Errorf("ParseFilter(%q): got %q at %d, want %q at %d", tt.src, syntaxErr.Msg, syntaxErr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestParseFilterMatch(t *testing.T) {
+	row := &Row{Key: RowKey("user/42"), Value: RowValue(`{"status":"failed","tags":["a","b"],"n":12}`)}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"key:^user/", true},
+		{"key:^order/", false},
+		{`json.status="failed"`, true},
+		{"json.status=failed AND json.n>10", true},
+		{"json.n<10 OR json.tags~b", true},
+		{"NOT json.missing", true},
+		{"(key~42 OR key~43) valuesize>1kb", false},
+		{"size>=1KB", false},
+		{"json.tags.1=b", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.src)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.Match(row); got != tt.want {
+			t.Errorf("ParseFilter(%q).Match: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
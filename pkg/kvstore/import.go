@@ -0,0 +1,290 @@
+package kvstore
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ConflictPolicy defines what to do when writing a row whose key already exists.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep the existing row
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace the existing value
+	ConflictFail      ConflictPolicy = "fail"      // abort with ErrAlreadyExists (nothing is written)
+)
+
+// ConflictPolicies lists all supported conflict policies.
+var ConflictPolicies = []ConflictPolicy{ConflictSkip, ConflictOverwrite, ConflictFail}
+
+// ParseConflictPolicy returns the conflict policy with the given name, an empty name defaults to fail.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	if s == "" {
+		return ConflictFail, nil
+	}
+	for _, policy := range ConflictPolicies {
+		if string(policy) == s {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", s)
+}
+
+// ListRow is a row along with the list it belongs to.
+type ListRow struct {
+	List ListPath
+	Row  *Row
+}
+
+// WriteReport counts the changes made by a batch write.
+type WriteReport struct {
+	Matched      int `json:"matched"` // rows affected by a bulk operation
+	Created      int `json:"created"`
+	Updated      int `json:"updated"`
+	Skipped      int `json:"skipped"`
+	Deleted      int `json:"deleted"`
+	ListsCreated int `json:"lists_created"`
+}
+
+func (r *WriteReport) Add(other *WriteReport) {
+	r.Matched += other.Matched
+	r.Created += other.Created
+	r.Updated += other.Updated
+	r.Skipped += other.Skipped
+	r.Deleted += other.Deleted
+	r.ListsCreated += other.ListsCreated
+}
+
+// RowReader reads rows from an export file.
+type RowReader interface {
+	// ReadRow returns the next row and its list (nil if the file doesn't specify it),
+	// or io.EOF when there are no more rows.
+	ReadRow() (ListPath, *Row, error)
+}
+
+// NewRowReader returns a row reader for files written by a RowWriter with the same format and encoding.
+func NewRowReader(r io.Reader, format ExportFormat, enc Encoding) (RowReader, error) {
+	switch format {
+	case ExportFormatNDJSON:
+		return &ndjsonRowReader{d: json.NewDecoder(bufio.NewReader(r)), enc: enc}, nil
+	case ExportFormatJSON:
+		return &jsonRowReader{d: json.NewDecoder(bufio.NewReader(r)), enc: enc}, nil
+	case ExportFormatCSV:
+		return &csvRowReader{r: csv.NewReader(bufio.NewReader(r)), enc: enc}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ImportOptions configures how rows are written by Import.
+type ImportOptions struct {
+	DefaultList ListPath // used for rows that don't specify their list
+	OnConflict  ConflictPolicy
+	DryRun      bool // count changes without writing anything (the batch size is ignored)
+	BatchSize   int  // number of rows per transaction, all rows are written in a single transaction if <= 0
+}
+
+// Import reads all rows from the row reader and writes them to the DB.
+// Missing lists are created.
+// With the default batch size (<= 0), the whole file is held in memory and written in a single transaction.
+// If an error occurs, the report counts the changes of the batches that were already committed along with the error
+// (the rows of the failed batch and the following rows are not written).
+func Import(db DB, rr RowReader, opts *ImportOptions) (*WriteReport, error) {
+	report := &WriteReport{}
+	batch := []*ListRow{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batchReport, err := db.PutRows(batch, opts.OnConflict, opts.DryRun)
+		if err != nil {
+			return err
+		}
+		report.Add(batchReport)
+		batch = batch[:0]
+		return nil
+	}
+	for i := 1; ; i++ {
+		list, row, err := rr.ReadRow()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return report, fmt.Errorf("row %d: %w", i, err)
+		}
+		if list == nil {
+			list = opts.DefaultList
+		}
+		if len(list) == 0 {
+			return report, fmt.Errorf("row %d: no bucket specified", i)
+		}
+		batch = append(batch, &ListRow{List: list, Row: row})
+		// Dry runs use a single transaction since changes from previous batches would not be visible
+		if !opts.DryRun && opts.BatchSize > 0 && len(batch) >= opts.BatchSize {
+			err = flush()
+			if err != nil {
+				return report, fmt.Errorf("rows %d to %d: %w", i-len(batch)+1, i, err)
+			}
+		}
+	}
+	return report, flush()
+}
+
+// Decodes a record read from a NDJSON or CSV file.
+func decodeExportRecord(enc Encoding, record *ExportRecord) (ListPath, *Row, error) {
+	var err error
+	var list ListPath
+	if record.List != "" {
+		list, err = ParseListPath(record.List)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	row := &Row{}
+	row.Key, err = enc.Decode(record.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	row.Value, err = enc.Decode(record.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return list, row, nil
+}
+
+type ndjsonRowReader struct {
+	d   *json.Decoder
+	enc Encoding
+}
+
+func (rr *ndjsonRowReader) ReadRow() (ListPath, *Row, error) {
+	record := &ExportRecord{}
+	err := rr.d.Decode(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeExportRecord(rr.enc, record)
+}
+
+// Reads {"key": "value", ...} or {"list": {"key": "value", ...}, ...} objects token by token
+// so that large files don't have to fit in memory.
+type jsonRowReader struct {
+	d           *json.Decoder
+	enc         Encoding
+	started     bool     // true once the opening brace has been read
+	inList      bool     // true while reading rows of a list object
+	currentList ListPath // list of the object being read
+}
+
+func (rr *jsonRowReader) ReadRow() (ListPath, *Row, error) {
+	if !rr.started {
+		rr.started = true
+		err := expectJSONDelim(rr.d, '{')
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for {
+		if !rr.d.More() {
+			if !rr.inList {
+				return nil, nil, io.EOF
+			}
+			rr.inList = false
+			err := expectJSONDelim(rr.d, '}')
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		// Read key and check whether it is followed by a value or a list object
+		key, err := readJSONString(rr.d)
+		if err != nil {
+			return nil, nil, err
+		}
+		token, err := rr.d.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		if token == json.Delim('{') {
+			if rr.inList {
+				return nil, nil, errors.New("unexpected nested object")
+			}
+			rr.currentList, err = ParseListPath(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			rr.inList = true
+			continue
+		}
+		value, ok := token.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("value of %q is not a string", key)
+		}
+		list := ListPath(nil)
+		if rr.inList {
+			list = rr.currentList
+		}
+		_, row, err := decodeExportRecord(rr.enc, &ExportRecord{Key: key, Value: value})
+		return list, row, err
+	}
+}
+
+func expectJSONDelim(d *json.Decoder, delim json.Delim) error {
+	token, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q but got %v", delim, token)
+	}
+	return nil
+}
+
+func readJSONString(d *json.Decoder) (string, error) {
+	token, err := d.Token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("expected string but got %v", token)
+	}
+	return s, nil
+}
+
+// Reads CSV files with a "key,value" or "bucket,key,value" header.
+type csvRowReader struct {
+	r        *csv.Reader
+	enc      Encoding
+	started  bool // true once the header has been read
+	withList bool
+}
+
+func (rr *csvRowReader) ReadRow() (ListPath, *Row, error) {
+	if !rr.started {
+		rr.started = true
+		header, err := rr.r.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case len(header) == 2 && header[0] == "key" && header[1] == "value":
+		case len(header) == 3 && header[0] == "bucket" && header[1] == "key" && header[2] == "value":
+			rr.withList = true
+		default:
+			return nil, nil, fmt.Errorf("invalid CSV header %q", header)
+		}
+	}
+	fields, err := rr.r.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	record := &ExportRecord{Key: fields[0], Value: fields[1]}
+	if rr.withList {
+		record = &ExportRecord{List: fields[0], Key: fields[1], Value: fields[2]}
+	}
+	return decodeExportRecord(rr.enc, record)
+}
@@ -0,0 +1,116 @@
+package kvstore_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ejuju/boltdb-webgui/pkg/boltutil"
+	"github.com/ejuju/boltdb-webgui/pkg/kvstore"
+)
+
+func newTestDB(t *testing.T) *boltutil.KeyValueDB {
+	t.Helper()
+	db := boltutil.NewKeyValueDB(filepath.Join(t.TempDir(), "test.boltdb"), false)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Returns the rows of the lists as "list/key" -> value.
+func readTestRows(t *testing.T, db kvstore.DB, lists []kvstore.ListPath) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	err := db.ReadEachRowInLists(lists, &kvstore.KeyRange{}, func(list kvstore.ListPath, r *kvstore.Row) error {
+		out[list.String()+"/"+string(r.Key)] = string(r.Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestNDJSONExportImportRoundTrip(t *testing.T) {
+	lists := []kvstore.ListPath{{"bin"}, {"bin", "nested/list"}}
+	rows := []*kvstore.ListRow{
+		{List: lists[0], Row: &kvstore.Row{Key: kvstore.RowKey("\x00"), Value: kvstore.RowValue("zero")}},
+		{List: lists[0], Row: &kvstore.Row{Key: kvstore.RowKey("\xff\xfe\n"), Value: kvstore.RowValue("\x00\x01\x02")}},
+		{List: lists[0], Row: &kvstore.Row{Key: kvstore.RowKey(`{"key":"a/b"}`), Value: kvstore.RowValue("\"quoted\"\r\n")}},
+		{List: lists[1], Row: &kvstore.Row{Key: kvstore.RowKey("\x00\x00\x00\x00\x00\x00\x00\x2a"), Value: kvstore.RowValue("\xc3\x28")}},
+	}
+	src := newTestDB(t)
+	_, err := src.PutRows(rows, kvstore.ConflictFail, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readTestRows(t, src, lists)
+	if len(want) != len(rows) {
+		t.Fatalf("got %d rows in the source DB, want %d", len(want), len(rows))
+	}
+
+	for _, enc := range []kvstore.Encoding{kvstore.EncodingBase64, kvstore.EncodingHex} {
+		buf := &bytes.Buffer{}
+		rw, err := kvstore.NewRowWriter(buf, kvstore.ExportFormatNDJSON, enc, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = kvstore.Export(src, rw, lists)
+		if err != nil {
+			t.Fatalf("%s: export: %v", enc, err)
+		}
+
+		dst := newTestDB(t)
+		rr, err := kvstore.NewRowReader(buf, kvstore.ExportFormatNDJSON, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := kvstore.Import(dst, rr, &kvstore.ImportOptions{OnConflict: kvstore.ConflictFail, BatchSize: 3})
+		if err != nil {
+			t.Fatalf("%s: import: %v", enc, err)
+		}
+		if report.Created != len(rows) || report.ListsCreated != len(lists) {
+			t.Errorf("%s: got report %+v, want %d rows and %d lists created", enc, report, len(rows), len(lists))
+		}
+		if got := readTestRows(t, dst, lists); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got rows %q, want %q", enc, got, want)
+		}
+	}
+}
+
+func TestNDJSONImportIntoDefaultList(t *testing.T) {
+	list := kvstore.ListPath{"bin"}
+	src := newTestDB(t)
+	_, err := src.PutRows([]*kvstore.ListRow{
+		{List: list, Row: &kvstore.Row{Key: kvstore.RowKey("\xff"), Value: kvstore.RowValue("\x00")}},
+	}, kvstore.ConflictFail, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	rw, err := kvstore.NewRowWriter(buf, kvstore.ExportFormatNDJSON, kvstore.EncodingBase64, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = kvstore.Export(src, rw, []kvstore.ListPath{list})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows without a list are written to the default list
+	dst := newTestDB(t)
+	target := kvstore.ListPath{"copy"}
+	rr, err := kvstore.NewRowReader(buf, kvstore.ExportFormatNDJSON, kvstore.EncodingBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = kvstore.Import(dst, rr, &kvstore.ImportOptions{DefaultList: target, OnConflict: kvstore.ConflictFail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readTestRows(t, dst, []kvstore.ListPath{target})
+	if want := map[string]string{"copy/\xff": "\x00"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// JSONPath identifies a field in a JSON value, each segment is an object key or an array index.
+type JSONPath []string
+
+// ParseJSONPath parses a dot-separated path (e.g. "items.0.name").
+func ParseJSONPath(s string) (JSONPath, error) {
+	if s == "" {
+		return nil, errors.New("empty JSON path")
+	}
+	path := JSONPath(strings.Split(s, "."))
+	for _, segment := range path {
+		if segment == "" {
+			return nil, errors.New("empty segment in JSON path " + strconv.Quote(s))
+		}
+	}
+	return path, nil
+}
+
+func (p JSONPath) String() string { return strings.Join(p, ".") }
+
+// Lookup returns the value at the path in a decoded JSON value.
+func (p JSONPath) Lookup(v any) (any, bool) {
+	for _, segment := range p {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// JSONValueString returns strings as is and other values in their JSON representation.
+func JSONValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Decodes a row value as JSON (numbers are kept as json.Number), ok is false if the value is not valid JSON.
+func decodeJSONValue(v RowValue) (out any, ok bool) {
+	d := json.NewDecoder(bytes.NewReader(v))
+	d.UseNumber()
+	if d.Decode(&out) != nil || d.More() {
+		return nil, false
+	}
+	return out, true
+}
@@ -0,0 +1,33 @@
+package kvstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		src  string
+		want JSONPath
+		err  string
+	}{
+		{"a", JSONPath{"a"}, ""},
+		{"items.0.name", JSONPath{"items", "0", "name"}, ""},
+		{"", nil, "empty JSON path"},
+		{"a..b", nil, `empty segment in JSON path "a..b"`},
+		{".a", nil, `empty segment in JSON path ".a"`},
+		{"a.", nil, `empty segment in JSON path "a."`},
+	}
+	for _, tt := range tests {
+		got, err := ParseJSONPath(tt.src)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseJSONPath(%q): got error %v, want %q", tt.src, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseJSONPath(%q): got %#v, %v, want %#v", tt.src, got, err, tt.want)
+		}
+	}
+}
@@ -5,37 +5,143 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
+	"io"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type DB interface {
 	// General information
 	Size() (uint64, error)     // size of DB according to DB
+	TxID() (int, error)        // ID of the last committed transaction
 	DiskSize() (uint64, error) // size of disk file(s)
+	FreeSize() (uint64, error) // size of free pages that are kept in the disk file(s) for reuse
 	DiskPath() string
+	ReadOnly() bool // write operations return ErrReadOnly when true
 	NumLists() (int, error)
-	NumRows(list string) (uint64, error)
+	NumRows(list ListPath) (uint64, error) // reads every row, use ListExists for existence checks
+	ListExists(list ListPath) (bool, error)
+	Stats() (*DBStats, error)
+	ListStats(list ListPath) (*ListStats, error)
+	ReadListInfos(estimate bool, onProgress func(done int)) ([]*ListInfo, error) // all lists depth-first from a single snapshot, see EstimateListInfo
 
 	// List operations
-	CreateList(name string) error
-	ReadEachList(callback func(string) error) error
-	DeleteList(name string) error
+	CreateList(path ListPath) error
+	ReadEachList(callback func(ListPath) error) error // walks nested lists depth-first
+	DeleteList(path ListPath) error
+	RenameList(path, newPath ListPath) error // moves nested lists and keeps the sequence, the new parent must exist
+	CopyList(path, newPath ListPath) error   // copies nested lists and the sequence, the new parent must exist
 
 	// List row operations
-	CreateRow(list string, row *Row) error
-	ReadRow(list string, key string) (*Row, error)
-	ReadRowPage(list string, pageIndex, numRowsPerPage int) ([]*Row, error)
-	ReadEachRow(list string, callback func(*Row) error) error
-	UpdateRow(list string, key string, newValue string) error
-	DeleteRow(list string, name string) error
+	CreateRow(list ListPath, row *Row) error
+	ReadRow(list ListPath, key RowKey) (*Row, error)
+	ReadRowPage(list ListPath, pageIndex, numRowsPerPage int) ([]*Row, error)
+	ReadRowCursor(list ListPath, cursor *RowCursor) (*RowCursorPage, error)
+	ReadEachRow(list ListPath, callback func(*Row) error) error
+	ReadEachRowInRange(list ListPath, keyRange *KeyRange, callback func(*Row) error) error              // seeks to the start of the range
+	ReadEachRowInLists(lists []ListPath, keyRange *KeyRange, callback func(ListPath, *Row) error) error // reads all lists from the same snapshot
+	UpdateRow(list ListPath, key RowKey, newValue RowValue) error
+	PutRow(list ListPath, row *Row) (created bool, err error)                 // creates the row or replaces its value
+	MoveRow(list ListPath, key RowKey, newList ListPath, newKey RowKey) error // renames the key and/or moves the row to another list
+	CopyRow(list ListPath, key RowKey, newList ListPath, newKey RowKey) error
+	DeleteRow(list ListPath, key RowKey) error
+	DeleteRowsInRange(list ListPath, keyRange *KeyRange, dryRun bool) (*WriteReport, error) // nested lists are kept
+	TruncateList(list ListPath, dryRun bool) (*WriteReport, error)                          // deletes all rows, nested lists and the sequence are kept
+
+	// Batch operations (applied in a single transaction)
+	PutRows(rows []*ListRow, onConflict ConflictPolicy, dryRun bool) (*WriteReport, error) // creates missing lists
+	ApplyToRows(lists []ListPath, keyRange *KeyRange, match RowMatcher, op *BulkOperation, dryRun bool) (*WriteReport, error)
+
+	// Maintenance
+	Backup(w io.Writer, onStart func(size int64)) (int64, error) // writes a consistent snapshot, onStart is called with its size before writing
+	Compact() (*CompactReport, error)                            // rewrites the disk file(s) without free space, blocks writes
+	ReadPageMap(offset, limit int) (*PageMap, error)             // lists pages starting at the given page ID
+	ReadPage(id uint64) (*PageContent, error)
+	// Verifies the consistency of the disk file(s), onProgress (may be nil) is called periodically
+	Check(onIssue func(*CheckIssue) error, onProgress func(*CheckProgress)) (*CheckReport, error)
 }
 
 var ErrAlreadyExists = errors.New("already exists")
 var ErrNotFound = errors.New("not found")
+var ErrReadOnly = errors.New("database is open in read-only mode")
+var ErrBusy = errors.New("database is busy, try again later")
 
 func NewErrNotFound(id string) error      { return fmt.Errorf("%q %w", id, ErrNotFound) }
 func NewErrAlreadyExists(id string) error { return fmt.Errorf("%q %w", id, ErrAlreadyExists) }
 
+// ListPath identifies a list by the names of its parent lists followed by its own name.
+// A path with a single name refers to a top-level list.
+type ListPath []string
+
+// ParseListPath parses a path previously encoded with ListPath.String.
+func ParseListPath(s string) (ListPath, error) {
+	if s == "" {
+		return nil, errors.New("empty list path")
+	}
+	var out ListPath
+	for _, segment := range strings.Split(s, "/") {
+		name, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, fmt.Errorf("parse list path %q: %w", s, err)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// String encodes the path so it can be used in URLs and forms (names are escaped and joined with "/").
+func (p ListPath) String() string {
+	segments := make([]string, len(p))
+	for i, name := range p {
+		segments[i] = url.PathEscape(name)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Display returns a human-readable version of the path.
+func (p ListPath) Display() string { return strings.Join(p, " / ") }
+
+// Name returns the name of the list itself (without its parents).
+func (p ListPath) Name() string {
+	if len(p) == 0 {
+		return ""
+	}
+	return p[len(p)-1]
+}
+
+// Depth returns the nesting level of the list, top-level lists have a depth of 0.
+func (p ListPath) Depth() int { return len(p) - 1 }
+
+// Child returns the path of a list nested in p.
+func (p ListPath) Child(name string) ListPath {
+	out := make(ListPath, len(p), len(p)+1)
+	copy(out, p)
+	return append(out, name)
+}
+
+// Ancestors returns the path of each parent list followed by p itself, starting with the top-level list.
+func (p ListPath) Ancestors() []ListPath {
+	out := make([]ListPath, len(p))
+	for i := range p {
+		out[i] = p[:i+1]
+	}
+	return out
+}
+
+// Contains reports whether other is p itself or one of its nested lists.
+func (p ListPath) Contains(other ListPath) bool {
+	if len(other) < len(p) {
+		return false
+	}
+	for i, name := range p {
+		if other[i] != name {
+			return false
+		}
+	}
+	return true
+}
+
 // Row represents a key-value pair in a list.
 type Row struct {
 	Key   RowKey
@@ -46,6 +152,41 @@ func (r *Row) Size() uint64      { return r.KeySize() + r.ValueSize() }
 func (r *Row) ValueSize() uint64 { return uint64(len(r.Value)) }
 func (r *Row) KeySize() uint64   { return uint64(len(r.Key)) }
 
+// RowCursor describes a page of rows positioned by key rather than by offset.
+type RowCursor struct {
+	Seek    RowKey // first key of the page (or the closest key after it), the first row is used when nil
+	Prefix  RowKey // only rows whose key starts with this prefix are read
+	Reverse bool   // iterate from the last key to the first one
+	Last    bool   // read the last page (Seek is ignored)
+	Limit   int    // maximum number of rows in the page
+}
+
+// RowCursorPage is a page of rows read with a RowCursor.
+type RowCursorPage struct {
+	Rows []*Row
+	Prev RowKey // seek key for the previous page, nil if this is the first page
+	Next RowKey // seek key for the next page, nil if this is the last page
+}
+
+// KeyRange restricts iteration to keys that start with a prefix and/or are within bounds.
+type KeyRange struct {
+	Prefix RowKey // ignored if empty
+	Start  RowKey // inclusive lower bound, ignored if empty
+	End    RowKey // exclusive upper bound, ignored if empty
+}
+
+// Contains reports whether the key is in the range.
+func (kr *KeyRange) Contains(key RowKey) bool {
+	return bytes.HasPrefix(key, kr.Prefix) &&
+		(len(kr.Start) == 0 || bytes.Compare(key, kr.Start) >= 0) &&
+		(len(kr.End) == 0 || bytes.Compare(key, kr.End) < 0)
+}
+
+// IsEmpty reports whether the range doesn't restrict keys.
+func (kr *KeyRange) IsEmpty() bool {
+	return len(kr.Prefix) == 0 && len(kr.Start) == 0 && len(kr.End) == 0
+}
+
 type RowKey []byte
 type RowValue []byte
 
@@ -54,25 +195,53 @@ func (k RowKey) String() string   { return string(k) }
 func (v RowValue) String() string { return string(v) }
 
 type DBInfo struct {
-	Size     uint64
-	DiskSize uint64
-	NumLists int
-	Lists    map[string]*ListInfo
+	Size            uint64      `json:"size"`
+	DiskSize        uint64      `json:"disk_size"`
+	FreeSize        uint64      `json:"free_size"`
+	ReclaimableSize uint64      `json:"reclaimable_size"` // upper bound of the disk space freed by compaction (bbolt preallocates file space as it grows)
+	NumLists        int         `json:"num_lists"`
+	TxID            int         `json:"tx_id"`     // ID of the last transaction when the info was computed
+	Estimated       bool        `json:"estimated"` // row counts and sizes are estimated (see EstimateListInfo)
+	Stats           *DBStats    `json:"stats"`
+	Lists           []*ListInfo `json:"lists"` // ordered depth-first, nested lists follow their parent
 }
 
+// CompactReport holds the disk size before and after a compaction.
+type CompactReport struct {
+	DiskSizeBefore uint64        `json:"disk_size_before"`
+	DiskSizeAfter  uint64        `json:"disk_size_after"`
+	Duration       time.Duration `json:"duration"`
+}
+
+// Reclaimed returns the number of bytes freed by the compaction.
+func (r *CompactReport) Reclaimed() int64 { return int64(r.DiskSizeBefore) - int64(r.DiskSizeAfter) }
+
 type ListInfo struct {
-	NumRows      uint64 // Number of keys in bucket
-	TotalRowSize uint64 // Sum of size of each row's key and value
-	AvgRowSize   uint64 // Average size of a row in the bucket
+	Path         ListPath   `json:"path"`
+	NumRows      uint64     `json:"num_rows"`       // Number of keys in bucket
+	TotalRowSize uint64     `json:"total_row_size"` // Sum of size of each row's key and value
+	AvgRowSize   uint64     `json:"avg_row_size"`   // Average size of a row in the bucket
+	Stats        *ListStats `json:"stats"`
+}
+
+// DBInfoOptions configures how DB info is computed.
+type DBInfoOptions struct {
+	WithoutLists bool                  // only get DB-wide sizes and stats
+	Estimate     bool                  // estimate row counts and sizes from list stats instead of reading every row
+	OnProgress   func(done, total int) // called after each list
 }
 
-func GetDBInfo(db DB) (*DBInfo, error) {
+func GetDBInfo(db DB) (*DBInfo, error) { return GetDBInfoWithOptions(db, &DBInfoOptions{}) }
+
+func GetDBInfoWithOptions(db DB, opts *DBInfoOptions) (*DBInfo, error) {
 	var err error
 
-	info := &DBInfo{
-		Lists: make(map[string]*ListInfo),
-	}
+	info := &DBInfo{Estimated: opts.Estimate}
 
+	info.TxID, err = db.TxID()
+	if err != nil {
+		return nil, err
+	}
 	info.DiskSize, err = db.DiskSize()
 	if err != nil {
 		return nil, err
@@ -81,91 +250,39 @@ func GetDBInfo(db DB) (*DBInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	// Get bucket stats for each bucket
-	err = db.ReadEachList(func(listName string) error {
-		info.NumLists++
-		listInfo, err := GetListInfo(db, listName)
-		if err != nil {
-			return err
-		}
-		info.Lists[listName] = listInfo
-		return nil
-	})
+	info.FreeSize, err = db.FreeSize()
 	if err != nil {
 		return nil, err
 	}
+	// Free pages and the unused end of the file can be reclaimed
+	if used := info.Size - info.FreeSize; info.FreeSize < info.Size && info.DiskSize > used {
+		info.ReclaimableSize = info.DiskSize - used
+	}
 
-	return info, nil
-}
-
-func GetListInfo(db DB, listName string) (*ListInfo, error) {
-	info := &ListInfo{}
-
-	// Calculate total row size
-	err := db.ReadEachRow(listName, func(r *Row) error {
-		info.TotalRowSize += r.Size()
-		return nil
-	})
+	info.Stats, err = db.Stats()
 	if err != nil {
 		return nil, err
 	}
 
-	// Set num rows
-	info.NumRows, err = db.NumRows(listName)
+	// Count lists first to report progress
+	info.NumLists, err = db.NumLists()
 	if err != nil {
 		return nil, err
 	}
-
-	// Calculate average only if rows are present
-	if info.NumRows != 0 {
-		info.AvgRowSize = info.TotalRowSize / info.NumRows
+	if opts.WithoutLists {
+		return info, nil
 	}
 
-	return info, nil
-}
-
-type SearchResult struct {
-	TotalResults uint64
-	Rows         []*SearchResultRow
-}
-
-type SearchResultRow struct {
-	ListID string
-	Row    *Row
-	Match  string
-}
-
-func Search(db DB, lists []string, regex *regexp.Regexp, excludeMatches bool, page, numRowsPerPage int) (*SearchResult, error) {
-	out := &SearchResult{}
-	offset := page * numRowsPerPage
-	for _, list := range lists {
-		// For each list to search in, return rows matching regex (or all rows if no regex was provided)
-		i := 0 // offset counter for pagination
-		err := db.ReadEachRow(list, func(r *Row) error {
-			defer func() { i++ }() // increment i after each callback iteration
-			resultRow := &SearchResultRow{ListID: list, Row: r, Match: ""}
-			if regex != nil {
-				resultRow.Match = regex.FindString(r.Value.String())
-				if (excludeMatches && resultRow.Match != "") || (!excludeMatches && resultRow.Match == "") {
-					return nil
-				}
-				out.TotalResults++
-			} else {
-				out.TotalResults++
-			}
-			if i >= offset && len(out.Rows) < numRowsPerPage {
-				resultRow.Row.Value = autoFormatRowValue(resultRow.Row.Value)
-				out.Rows = append(out.Rows, resultRow)
-			}
-			return nil
-		})
-		if err != nil {
-			return nil, err
+	info.Lists, err = db.ReadListInfos(opts.Estimate, func(done int) {
+		if opts.OnProgress != nil {
+			opts.OnProgress(done, info.NumLists)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return out, nil
+	return info, nil
 }
 
 func autoFormatRowValue(v RowValue) RowValue {
@@ -0,0 +1,50 @@
+package kvstore
+
+// Page types reported in page maps.
+const (
+	PageTypeMeta     = "meta"
+	PageTypeFreelist = "freelist"
+	PageTypeBranch   = "branch"
+	PageTypeLeaf     = "leaf"
+	PageTypeFree     = "free"
+)
+
+// PageInfo describes a page of the DB file (along with its overflow pages).
+type PageInfo struct {
+	ID       uint64   `json:"id"`
+	Type     string   `json:"type"`
+	Overflow int      `json:"overflow"`       // number of additional contiguous pages
+	Count    int      `json:"count"`          // number of elements stored in the page
+	Size     int      `json:"size"`           // allocated bytes (including overflow pages)
+	Used     int      `json:"used"`           // bytes used by the header and elements
+	List     ListPath `json:"list,omitempty"` // list owning the page, empty for meta, freelist, free and top-level pages
+}
+
+// FillRatio returns the fraction of the allocated bytes that are used (between 0 and 1).
+func (p *PageInfo) FillRatio() float64 {
+	if p.Size == 0 {
+		return 0
+	}
+	return float64(p.Used) / float64(p.Size)
+}
+
+// PageMap lists a range of pages of the DB file.
+type PageMap struct {
+	PageSize int         `json:"page_size"`
+	NumPages int         `json:"num_pages"` // total number of pages (below the high water mark)
+	Pages    []*PageInfo `json:"pages"`
+}
+
+// PageElement is an element stored in a branch or leaf page.
+type PageElement struct {
+	Key       RowKey `json:"key"`
+	ValueSize int    `json:"value_size,omitempty"` // leaf pages only
+	IsList    bool   `json:"is_list,omitempty"`    // the element is a nested list (leaf pages only)
+	Child     uint64 `json:"child,omitempty"`      // ID of the child page (branch pages only)
+}
+
+// PageContent holds the elements of a branch or leaf page.
+type PageContent struct {
+	Page     *PageInfo      `json:"page"`
+	Elements []*PageElement `json:"elements"`
+}
@@ -0,0 +1,54 @@
+package kvstore
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// ValueReplacement substitutes regex matches in row values.
+type ValueReplacement struct {
+	Regex       *regexp.Regexp
+	Replacement string // can reference submatches with $1 or ${name} (see regexp.Regexp.Expand)
+}
+
+// Apply returns the value with every match replaced, and whether it changed.
+func (rep *ValueReplacement) Apply(v RowValue) (RowValue, bool) {
+	out := rep.Regex.ReplaceAll(v, []byte(rep.Replacement))
+	return out, !bytes.Equal(out, v)
+}
+
+// ReplacePreview shows the changes made to a value by a replacement.
+type ReplacePreview struct {
+	Before   string       `json:"before"`
+	After    string       `json:"after"`
+	Removed  []MatchRange `json:"removed"`  // matches in Before
+	Inserted []MatchRange `json:"inserted"` // replacements in After
+}
+
+// Changed reports whether the replacement changes the value.
+func (p *ReplacePreview) Changed() bool { return p.Before != p.After }
+
+// Preview returns the value before and after the replacement, nil if the regex doesn't match.
+func (rep *ValueReplacement) Preview(v RowValue) *ReplacePreview {
+	locs := rep.Regex.FindAllSubmatchIndex(v, -1)
+	if locs == nil {
+		return nil
+	}
+	out := &ReplacePreview{Before: string(v)}
+	after := []byte{}
+	prevEnd := 0
+	for _, loc := range locs {
+		after = append(after, v[prevEnd:loc[0]]...)
+		start := len(after)
+		after = rep.Regex.Expand(after, []byte(rep.Replacement), v, loc)
+		if loc[0] < loc[1] {
+			out.Removed = append(out.Removed, MatchRange{Start: loc[0], End: loc[1]})
+		}
+		if start < len(after) {
+			out.Inserted = append(out.Inserted, MatchRange{Start: start, End: len(after)})
+		}
+		prevEnd = loc[1]
+	}
+	out.After = string(append(after, v[prevEnd:]...))
+	return out
+}
@@ -0,0 +1,458 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// SearchTarget defines which part of a row is matched against a search regex.
+type SearchTarget string
+
+const (
+	SearchTargetValue SearchTarget = "value"
+	SearchTargetKey   SearchTarget = "key"
+	SearchTargetBoth  SearchTarget = "both" // the key or the value
+)
+
+// SearchTargets lists all supported search targets.
+var SearchTargets = []SearchTarget{SearchTargetValue, SearchTargetKey, SearchTargetBoth}
+
+// ParseSearchTarget returns the search target with the given name, an empty name defaults to value.
+func ParseSearchTarget(s string) (SearchTarget, error) {
+	if s == "" {
+		return SearchTargetValue, nil
+	}
+	for _, target := range SearchTargets {
+		if string(target) == s {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("unknown search target %q", s)
+}
+
+// SearchQuery defines which rows are returned by Search.
+type SearchQuery struct {
+	Lists    []ListPath
+	Regex    *regexp.Regexp // all rows match if nil
+	Target   SearchTarget
+	Exclude  bool              // return rows that don't match the regex instead
+	KeyRange KeyRange          // only rows in this key range are read
+	Filter   *Filter           // only rows matching the filter are searched, ignored if nil
+	Fields   []JSONPath        // JSON fields to project into results (see SearchResultRow.Fields)
+	Workers  int               // number of lists scanned concurrently (one at a time if <= 0)
+	Sort     SearchSort        // results are in list order then key order by default
+	Replace  *ValueReplacement // preview replacements in values (see SearchResultRow.Replace), ignored if nil
+
+	MinValueSize uint64 // ignored if 0
+	MaxValueSize uint64 // ignored if 0
+}
+
+// Match reports whether the row matches the query (the key range, sort order and projected fields are ignored).
+func (q *SearchQuery) Match(list ListPath, r *Row) bool {
+	_, ok := q.matchRow(list, r)
+	return ok
+}
+
+// Returns the result row if the row matches the query (its key and value are not copied yet).
+func (q *SearchQuery) matchRow(list ListPath, r *Row) (*SearchResultRow, bool) {
+	if r.ValueSize() < q.MinValueSize || (q.MaxValueSize > 0 && r.ValueSize() > q.MaxValueSize) {
+		return nil, false
+	}
+	if q.Filter != nil && !q.Filter.Match(r) {
+		return nil, false
+	}
+	resultRow := &SearchResultRow{List: list, Row: r, Match: ""}
+	if q.Regex != nil {
+		resultRow.Match = q.match(r)
+		if (q.Exclude && resultRow.Match != "") || (!q.Exclude && resultRow.Match == "") {
+			return nil, false
+		}
+	}
+	return resultRow, true
+}
+
+// Returns the part of the row matching the regex (empty if it doesn't match).
+func (q *SearchQuery) match(r *Row) string {
+	if q.Target == SearchTargetKey || q.Target == SearchTargetBoth {
+		if match := q.Regex.Find(r.Key); match != nil {
+			return string(match)
+		}
+	}
+	if q.Target == SearchTargetValue || q.Target == SearchTargetBoth {
+		return q.Regex.FindString(r.Value.String())
+	}
+	return ""
+}
+
+// SearchResult is a page of search results.
+type SearchResult struct {
+	Rows      []*SearchResultRow
+	Next      *SearchCursor // position to resume the search from, nil if this is the last page
+	Truncated bool          // the search was stopped by its context before the page was full
+}
+
+// SearchCursor is the position of the last row read for a page of search results,
+// the next page starts right after it (or at the beginning of the list if Key is nil).
+type SearchCursor struct {
+	List ListPath
+	Key  RowKey
+	sort *searchSortValue // for sorted searches
+}
+
+// ErrInvalidPageToken is returned for page tokens that can't be decoded or don't match the search query.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Token encodes the cursor as an opaque URL-safe string.
+func (c *SearchCursor) Token() string {
+	b, err := json.Marshal(&searchToken{List: c.List.String(), Key: c.Key, Sort: c.sort})
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type searchToken struct {
+	List string           `json:"l"`
+	Key  []byte           `json:"k"`
+	Sort *searchSortValue `json:"s,omitempty"`
+}
+
+// ParseSearchPageToken decodes a token returned by SearchCursor.Token.
+func ParseSearchPageToken(s string) (*SearchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	token := &searchToken{}
+	err = json.Unmarshal(b, token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	list, err := ParseListPath(token.List)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	return &SearchCursor{List: list, Key: token.Key, sort: token.Sort}, nil
+}
+
+type SearchResultRow struct {
+	List         ListPath
+	Row          *Row
+	Match        string
+	KeyMatches   []MatchRange         // position of each regex match in the key
+	ValueMatches []MatchRange         // position of each regex match in the value
+	Fields       []*SearchResultField // one per projected field, in the same order as SearchQuery.Fields
+	Replace      *ReplacePreview      // changes made to the raw value by SearchQuery.Replace, nil if it doesn't match
+
+	// Value shown on the search page (JSON values are pretty-printed) and the position of regex matches in it.
+	DisplayValue        RowValue
+	DisplayValueMatches []MatchRange
+}
+
+// MatchRange is the position of a regex match in a key or value (in bytes, End is exclusive).
+type MatchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Copies the row's key and value and sets the projected fields, the displayed value and the position of regex matches.
+// The displayed value is the raw value if the regex doesn't match its pretty-printed version.
+func (resultRow *SearchResultRow) setRow(query *SearchQuery, r *Row) {
+	if len(query.Fields) > 0 {
+		resultRow.Fields = projectJSONFields(r.Value, query.Fields)
+	}
+	if query.Replace != nil {
+		resultRow.Replace = query.Replace.Preview(r.Value)
+	}
+	resultRow.Row = &Row{Key: append(RowKey{}, r.Key...), Value: append(RowValue{}, r.Value...)}
+	resultRow.DisplayValue = autoFormatRowValue(resultRow.Row.Value)
+	if query.Regex == nil || query.Exclude {
+		return
+	}
+	if query.Target == SearchTargetKey || query.Target == SearchTargetBoth {
+		resultRow.KeyMatches = findAllMatchRanges(query.Regex, resultRow.Row.Key)
+	}
+	if query.Target == SearchTargetValue || query.Target == SearchTargetBoth {
+		resultRow.ValueMatches = findAllMatchRanges(query.Regex, resultRow.Row.Value)
+		resultRow.DisplayValueMatches = findAllMatchRanges(query.Regex, resultRow.DisplayValue)
+		if resultRow.DisplayValueMatches == nil && resultRow.ValueMatches != nil {
+			resultRow.DisplayValue, resultRow.DisplayValueMatches = resultRow.Row.Value, resultRow.ValueMatches
+		}
+	}
+}
+
+func findAllMatchRanges(re *regexp.Regexp, b []byte) []MatchRange {
+	var out []MatchRange
+	for _, loc := range re.FindAllIndex(b, -1) {
+		if loc[0] < loc[1] { // empty matches can't be highlighted
+			out = append(out, MatchRange{Start: loc[0], End: loc[1]})
+		}
+	}
+	return out
+}
+
+// Snippet is an excerpt of a text around one or more matches.
+type Snippet struct {
+	Text      string
+	Matches   []MatchRange // relative to Text
+	HasBefore bool         // the text doesn't start with the snippet
+	HasAfter  bool         // the text doesn't end with the snippet
+}
+
+// Snippets returns excerpts of the text with up to context bytes before and after each match,
+// overlapping excerpts are merged.
+func Snippets(text string, matches []MatchRange, context int) []*Snippet {
+	out := []*Snippet{}
+	start, end := 0, 0 // bounds of the current snippet
+	lastMatchEnd := 0
+	var current []MatchRange
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		snippet := &Snippet{Text: text[start:end], HasBefore: start > 0, HasAfter: end < len(text)}
+		for _, m := range current {
+			snippet.Matches = append(snippet.Matches, MatchRange{Start: m.Start - start, End: m.End - start})
+		}
+		out = append(out, snippet)
+		current = nil
+	}
+	for _, m := range matches {
+		if m.Start < lastMatchEnd || m.End < m.Start || m.End > len(text) {
+			continue // overlapping, invalid or out of bounds
+		}
+		lastMatchEnd = m.End
+		// Extend to the given context without splitting UTF-8 characters
+		mStart, mEnd := m.Start-context, m.End+context
+		if mStart < 0 {
+			mStart = 0
+		}
+		for mStart > 0 && !utf8.RuneStart(text[mStart]) {
+			mStart--
+		}
+		if mEnd > len(text) {
+			mEnd = len(text)
+		}
+		for mEnd < len(text) && !utf8.RuneStart(text[mEnd]) {
+			mEnd++
+		}
+		if len(current) == 0 || mStart > end {
+			flush()
+			start = mStart
+		}
+		end = mEnd
+		current = append(current, m)
+	}
+	flush()
+	return out
+}
+
+// SearchResultField is the value of a JSON field projected into a search result.
+type SearchResultField struct {
+	Path  JSONPath
+	Value any  // decoded JSON value
+	Found bool // false if the row value is not JSON or doesn't have the field
+}
+
+func (f *SearchResultField) String() string { return JSONValueString(f.Value) }
+
+func projectJSONFields(v RowValue, paths []JSONPath) []*SearchResultField {
+	decoded, _ := decodeJSONValue(v)
+	out := make([]*SearchResultField, len(paths))
+	for i, path := range paths {
+		out[i] = &SearchResultField{Path: path}
+		out[i].Value, out[i].Found = path.Lookup(decoded)
+	}
+	return out
+}
+
+// Search returns up to limit rows matching the query, starting after the given cursor (or from the beginning if nil).
+// Lists are searched in the order of the query, the cursor's list must be one of them.
+//
+// Lists are scanned concurrently by query.Workers goroutines.
+// When the context is done, rows found so far are returned with Truncated set
+// and a cursor to resume from the last key read (except for sorted searches).
+func Search(ctx context.Context, db DB, query *SearchQuery, after *SearchCursor, limit int) (*SearchResult, error) {
+	if after != nil && (after.sort != nil) != (query.Sort.Field != SearchSortNone) {
+		return nil, fmt.Errorf("%w: the sort order has changed", ErrInvalidPageToken)
+	}
+	if query.Sort.Field != SearchSortNone {
+		return searchSorted(ctx, db, query, after, limit)
+	}
+	lists := query.Lists
+	if after != nil {
+		i := indexOfList(lists, after.List)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: bucket %q is not searched", ErrInvalidPageToken, after.List.Display())
+		}
+		lists = lists[i:]
+	}
+
+	// Scan lists, remaining scans are cancelled once the first lists fill the page
+	scans := make([]*listScan, len(lists))
+	mu := sync.Mutex{} // guards scans
+	forEachList(ctx, len(lists), query.Workers, func(ctx context.Context, i int, stop func()) {
+		var start RowKey
+		if i == 0 && after != nil {
+			start = after.Key
+		}
+		scan := scanListForSearch(ctx, db, query, lists[i], start, limit)
+		mu.Lock()
+		defer mu.Unlock()
+		scans[i] = scan
+		if isSearchPageFull(scans, limit) {
+			stop()
+		}
+	})
+
+	// Merge results in list order
+	out := &SearchResult{}
+	for i, list := range lists {
+		scan := scans[i]
+		if scan == nil {
+			// Not scanned because the context is done
+			out.Truncated = true
+			out.Next = &SearchCursor{List: list}
+			if i == 0 && after != nil {
+				out.Next.Key = after.Key
+			}
+			break
+		}
+		if scan.err != nil {
+			return nil, scan.err
+		}
+		for _, row := range scan.rows {
+			if len(out.Rows) == limit {
+				// Another row matches so there is a next page
+				last := out.Rows[len(out.Rows)-1]
+				return &SearchResult{Rows: out.Rows, Next: &SearchCursor{List: last.List, Key: last.Row.Key}}, nil
+			}
+			out.Rows = append(out.Rows, row)
+		}
+		if !scan.done {
+			out.Truncated = true
+			out.Next = &SearchCursor{List: list, Key: scan.last}
+			break
+		}
+	}
+	return out, nil
+}
+
+// Calls scan for each list index with a pool of workers (one if <= 0).
+// Once stop is called or the context is done, running scans are cancelled and no more are started.
+func forEachList(ctx context.Context, numLists, workers int, scan func(ctx context.Context, i int, stop func())) {
+	scanCtx, cancelScans := context.WithCancel(ctx)
+	defer cancelScans()
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	if workers <= 0 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				scan(scanCtx, i, cancelScans)
+			}
+		}()
+	}
+feed:
+	for i := 0; i < numLists; i++ {
+		select {
+		case jobs <- i:
+		case <-scanCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Rows matching a search in a single list.
+type listScan struct {
+	rows []*SearchResultRow // at most limit+1 rows
+	last RowKey             // last key read
+	done bool               // false if the scan was stopped by the context
+	err  error
+}
+
+// Used to stop iterating once enough rows were found.
+var errSearchPageFull = errors.New("search page full")
+
+func scanListForSearch(ctx context.Context, db DB, query *SearchQuery, list ListPath, after RowKey, limit int) *listScan {
+	// Resume right after the last key of the previous page
+	keyRange := query.KeyRange
+	if after != nil {
+		start := append(append(RowKey{}, after...), 0)
+		if bytes.Compare(start, keyRange.Start) > 0 {
+			keyRange.Start = start
+		}
+	}
+
+	// Return rows matching regex (or all rows if no regex was provided)
+	scan := &listScan{last: append(RowKey(nil), after...)}
+	err := db.ReadEachRowInRange(list, &keyRange, func(r *Row) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		defer func() { scan.last = append(scan.last[:0], r.Key...) }()
+		resultRow, ok := query.matchRow(list, r)
+		if !ok {
+			return nil
+		}
+		resultRow.setRow(query, r)
+		scan.rows = append(scan.rows, resultRow)
+		if len(scan.rows) > limit {
+			return errSearchPageFull
+		}
+		return nil
+	})
+	scan.done, scan.err = searchScanStatus(ctx, err)
+	return scan
+}
+
+// Returns whether a list was fully scanned, and the error to report (if the scan wasn't stopped on purpose).
+func searchScanStatus(ctx context.Context, err error) (bool, error) {
+	switch {
+	case err == nil, errors.Is(err, errSearchPageFull):
+		return true, nil
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return false, nil // stopped early, rows found so far are kept
+	}
+	return false, err
+}
+
+// Reports whether the lists scanned so far (from the first one) have more than limit rows.
+func isSearchPageFull(scans []*listScan, limit int) bool {
+	n := 0
+	for _, scan := range scans {
+		if scan == nil || scan.err != nil {
+			return false
+		}
+		n += len(scan.rows)
+		if n > limit {
+			return true
+		}
+		if !scan.done {
+			return false
+		}
+	}
+	return false
+}
+
+func indexOfList(lists []ListPath, path ListPath) int {
+	for i, list := range lists {
+		if list.String() == path.String() {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSnippets(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		matches []MatchRange
+		context int
+		want    []*Snippet
+	}{
+		{
+			name:    "ascii",
+			text:    "abcdef",
+			matches: []MatchRange{{Start: 1, End: 2}, {Start: 3, End: 4}},
+			context: 1,
+			want:    []*Snippet{{Text: "abcde", Matches: []MatchRange{{Start: 1, End: 2}, {Start: 3, End: 4}}, HasAfter: true}},
+		},
+		{
+			name:    "separate snippets",
+			text:    "a-----------b",
+			matches: []MatchRange{{Start: 0, End: 1}, {Start: 12, End: 13}},
+			context: 2,
+			want: []*Snippet{
+				{Text: "a--", Matches: []MatchRange{{Start: 0, End: 1}}, HasAfter: true},
+				{Text: "--b", Matches: []MatchRange{{Start: 2, End: 3}}, HasBefore: true},
+			},
+		},
+		{
+			name:    "context ends inside a character",
+			text:    "héllo wörld",
+			matches: []MatchRange{{Start: 7, End: 8}}, // "w"
+			context: 1,
+			want:    []*Snippet{{Text: " wö", Matches: []MatchRange{{Start: 1, End: 2}}, HasBefore: true, HasAfter: true}},
+		},
+		{
+			name:    "context starts inside a character",
+			text:    "日本語のテキスト",
+			matches: []MatchRange{{Start: 9, End: 12}}, // "の"
+			context: 4,
+			want:    []*Snippet{{Text: "本語のテキ", Matches: []MatchRange{{Start: 6, End: 9}}, HasBefore: true, HasAfter: true}},
+		},
+		{
+			name:    "overlapping, reversed and out of bounds matches are ignored",
+			text:    "abcdef",
+			matches: []MatchRange{{Start: 1, End: 2}, {Start: 1, End: 3}, {Start: 4, End: 3}, {Start: 4, End: 10}},
+			context: 0,
+			want:    []*Snippet{{Text: "b", Matches: []MatchRange{{Start: 0, End: 1}}, HasBefore: true, HasAfter: true}},
+		},
+		{
+			name:    "no matches",
+			text:    "abc",
+			context: 3,
+			want:    []*Snippet{},
+		},
+	}
+	for _, tt := range tests {
+		got := Snippets(tt.text, tt.matches, tt.context)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, formatSnippets(got), formatSnippets(tt.want))
+		}
+		for _, snippet := range got {
+			if !utf8.ValidString(snippet.Text) {
+				t.Errorf("%s: snippet %q is not valid UTF-8", tt.name, snippet.Text)
+			}
+		}
+	}
+}
+
+func formatSnippets(snippets []*Snippet) string {
+	out := ""
+	for _, s := range snippets {
+		out += fmt.Sprintf("%+v ", *s)
+	}
+	return out
+}
+
+func TestSearchPageToken(t *testing.T) {
+	cursors := []*SearchCursor{
+		{List: ListPath{"users"}},
+		{List: ListPath{"a/b", "c d"}, Key: RowKey("\x00\xffkey")},
+		{List: ListPath{"users"}, Key: RowKey("k1"), sort: &searchSortValue{Order: "json.n desc", Kind: sortKindNumber, Number: 1.5}},
+	}
+	for _, cursor := range cursors {
+		got, err := ParseSearchPageToken(cursor.Token())
+		if err != nil {
+			t.Errorf("ParseSearchPageToken(%q): %v", cursor.Token(), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, cursor) {
+			t.Errorf("ParseSearchPageToken(%q): got %+v, want %+v", cursor.Token(), got, cursor)
+		}
+	}
+}
+
+func TestParseSearchPageTokenTampered(t *testing.T) {
+	token := (&SearchCursor{List: ListPath{"users"}, Key: RowKey("k1")}).Token()
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"not base64", "!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"l":"users"}`))},
+		{"truncated", token[:len(token)-3]},
+		{"not JSON", encode("users/k1")},
+		{"not an object", encode("[1]")},
+		{"empty list", encode(`{"l":"","k":null}`)},
+		{"invalid list escape", encode(`{"l":"%zz","k":null}`)},
+		{"invalid key", encode(`{"l":"users","k":"%%"}`)},
+		{"invalid sort value", encode(`{"l":"users","k":null,"s":1}`)},
+	}
+	for _, tt := range tests {
+		_, err := ParseSearchPageToken(tt.token)
+		if !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("%s: got error %v, want ErrInvalidPageToken", tt.name, err)
+		}
+	}
+}
+
+// Tokens that decode but don't match the query are rejected before any list is read.
+func TestSearchRejectsMismatchedPageToken(t *testing.T) {
+	query := &SearchQuery{Lists: []ListPath{{"users"}}}
+	sortedQuery := &SearchQuery{Lists: []ListPath{{"users"}}, Sort: SearchSort{Field: SearchSortKey}}
+	sortValue := &searchSortValue{Order: "key", Kind: sortKindText, Text: []byte("k1")}
+	tests := []struct {
+		name   string
+		query  *SearchQuery
+		cursor *SearchCursor
+	}{
+		{"list not searched", query, &SearchCursor{List: ListPath{"orders"}}},
+		{"sorted token for unsorted search", query, &SearchCursor{List: ListPath{"users"}, sort: sortValue}},
+		{"unsorted token for sorted search", sortedQuery, &SearchCursor{List: ListPath{"users"}}},
+		{"list not searched (sorted)", sortedQuery, &SearchCursor{List: ListPath{"orders"}, sort: sortValue}},
+		{"sort order changed", sortedQuery, &SearchCursor{List: ListPath{"users"}, sort: &searchSortValue{Order: "key desc", Kind: sortKindText}}},
+	}
+	for _, tt := range tests {
+		cursor, err := ParseSearchPageToken(tt.cursor.Token())
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		_, err = Search(context.Background(), nil, tt.query, cursor, 10)
+		if !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("%s: got error %v, want ErrInvalidPageToken", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SearchSortField defines which value search results are sorted by.
+type SearchSortField string
+
+const (
+	SearchSortNone      SearchSortField = ""           // list order (as in the query), then key
+	SearchSortKey       SearchSortField = "key"        // key, then list order
+	SearchSortValueSize SearchSortField = "value_size" // value size, then list order and key
+	SearchSortBucket    SearchSortField = "bucket"     // list path, then key
+	SearchSortJSON      SearchSortField = "json"       // JSON field (see SearchSort.JSONPath), then list order and key
+)
+
+// SearchSortFields lists the sort fields that can be selected (JSON fields are entered as "json.<path>").
+var SearchSortFields = []SearchSortField{SearchSortNone, SearchSortKey, SearchSortValueSize, SearchSortBucket}
+
+// SearchSort defines the order of search results.
+//
+// Rows with a missing JSON field come last, numbers come before other JSON values (compared as text).
+type SearchSort struct {
+	Field    SearchSortField
+	JSONPath JSONPath // for SearchSortJSON
+	Desc     bool
+}
+
+// ParseSearchSort parses a sort field ("key", "value_size", "bucket" or "json.<path>"), an empty field keeps the default order.
+func ParseSearchSort(field string, desc bool) (SearchSort, error) {
+	if path, ok := strings.CutPrefix(field, "json."); ok {
+		jsonPath, err := ParseJSONPath(path)
+		if err != nil {
+			return SearchSort{}, err
+		}
+		return SearchSort{Field: SearchSortJSON, JSONPath: jsonPath, Desc: desc}, nil
+	}
+	for _, sortField := range SearchSortFields {
+		if string(sortField) == field {
+			return SearchSort{Field: sortField, Desc: desc}, nil
+		}
+	}
+	return SearchSort{}, fmt.Errorf("unknown sort field %q", field)
+}
+
+// String returns the sort field as accepted by ParseSearchSort.
+func (s SearchSort) String() string {
+	if s.Field == SearchSortJSON {
+		return "json." + s.JSONPath.String()
+	}
+	return string(s.Field)
+}
+
+// Identifies the sort field and direction in page tokens.
+func (s SearchSort) order() string {
+	if s.Desc {
+		return s.String() + " desc"
+	}
+	return s.String()
+}
+
+// Kinds of sort values, in ascending order.
+const (
+	sortKindNumber  = 1
+	sortKindText    = 2
+	sortKindMissing = 3
+)
+
+// Value a row is sorted by, stored in page tokens to resume sorted searches.
+type searchSortValue struct {
+	Order  string  `json:"o"` // sort field and direction, tokens can't be used with another order
+	Kind   int     `json:"t"`
+	Number float64 `json:"n,omitempty"`
+	Text   []byte  `json:"b,omitempty"`
+}
+
+func (v *searchSortValue) compare(other *searchSortValue) int {
+	switch {
+	case v.Kind != other.Kind:
+		return compareInts(int64(v.Kind), int64(other.Kind))
+	case v.Number < other.Number:
+		return -1
+	case v.Number > other.Number:
+		return 1
+	}
+	return bytes.Compare(v.Text, other.Text)
+}
+
+func newSearchSortValue(s SearchSort, list ListPath, r *Row) *searchSortValue {
+	switch s.Field {
+	case SearchSortKey:
+		return &searchSortValue{Kind: sortKindText, Text: append([]byte{}, r.Key...)}
+	case SearchSortValueSize:
+		return &searchSortValue{Kind: sortKindNumber, Number: float64(r.ValueSize())}
+	case SearchSortBucket:
+		return &searchSortValue{Kind: sortKindText, Text: []byte(list.String())}
+	case SearchSortJSON:
+		decoded, _ := decodeJSONValue(r.Value)
+		v, ok := s.JSONPath.Lookup(decoded)
+		if !ok {
+			return &searchSortValue{Kind: sortKindMissing}
+		}
+		if n, isNumber := v.(json.Number); isNumber {
+			if f, err := n.Float64(); err == nil {
+				return &searchSortValue{Kind: sortKindNumber, Number: f}
+			}
+		}
+		return &searchSortValue{Kind: sortKindText, Text: []byte(JSONValueString(v))}
+	}
+	return &searchSortValue{}
+}
+
+// Position of a matching row in sorted results, the row is read again once it is known to be returned.
+type sortedSearchRow struct {
+	value *searchSortValue
+	list  int // index in the query lists
+	key   RowKey
+}
+
+// Compares rows by sort value (missing JSON fields last), then list order and key.
+func compareSortedSearchRows(s SearchSort, a, b *sortedSearchRow) int {
+	if (a.value.Kind == sortKindMissing) != (b.value.Kind == sortKindMissing) {
+		if a.value.Kind == sortKindMissing {
+			return 1
+		}
+		return -1
+	}
+	cmp := a.value.compare(b.value)
+	if s.Desc {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp
+	}
+	if a.list != b.list {
+		return compareInts(int64(a.list), int64(b.list))
+	}
+	return bytes.Compare(a.key, b.key)
+}
+
+// Sorts rows and keeps the first n ones.
+func sortAndTruncate(s SearchSort, rows []*sortedSearchRow, n int) []*sortedSearchRow {
+	sort.Slice(rows, func(i, j int) bool { return compareSortedSearchRows(s, rows[i], rows[j]) < 0 })
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return rows
+}
+
+// Every matching row is read and only the first ones after the cursor are kept (limit+1 per list).
+func searchSorted(ctx context.Context, db DB, query *SearchQuery, after *SearchCursor, limit int) (*SearchResult, error) {
+	var cursor *sortedSearchRow
+	if after != nil {
+		cursor = &sortedSearchRow{value: after.sort, list: indexOfList(query.Lists, after.List), key: after.Key}
+		if cursor.list < 0 {
+			return nil, fmt.Errorf("%w: bucket %q is not searched", ErrInvalidPageToken, after.List.Display())
+		} else if cursor.value.Order != query.Sort.order() {
+			return nil, fmt.Errorf("%w: the sort order has changed", ErrInvalidPageToken)
+		}
+	}
+
+	// Scan all lists
+	scans := make([]*sortedListScan, len(query.Lists))
+	mu := sync.Mutex{} // guards scans
+	forEachList(ctx, len(query.Lists), query.Workers, func(ctx context.Context, i int, stop func()) {
+		scan := scanListForSortedSearch(ctx, db, query, i, cursor, limit)
+		mu.Lock()
+		defer mu.Unlock()
+		scans[i] = scan
+	})
+
+	// Merge results
+	out := &SearchResult{}
+	rows := []*sortedSearchRow{}
+	for _, scan := range scans {
+		if scan == nil || !scan.done {
+			out.Truncated = true // rows found so far are returned, but without a next page
+		}
+		if scan == nil {
+			continue
+		}
+		if scan.err != nil {
+			return nil, scan.err
+		}
+		rows = append(rows, scan.rows...)
+	}
+	rows = sortAndTruncate(query.Sort, rows, limit+1)
+	for i, row := range rows {
+		if i == limit {
+			if !out.Truncated {
+				last := rows[limit-1]
+				last.value.Order = query.Sort.order()
+				out.Next = &SearchCursor{List: query.Lists[last.list], Key: last.key, sort: last.value}
+			}
+			break
+		}
+
+		// Rows deleted or changed to no longer match since the scan are left out
+		list := query.Lists[row.list]
+		r, err := db.ReadRow(list, row.key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		resultRow, ok := query.matchRow(list, r)
+		if !ok {
+			continue
+		}
+		resultRow.setRow(query, r)
+		out.Rows = append(out.Rows, resultRow)
+	}
+	return out, nil
+}
+
+// Rows matching a sorted search in a single list.
+type sortedListScan struct {
+	rows []*sortedSearchRow // first limit+1 rows (in sort order)
+	done bool               // false if the scan was stopped by the context
+	err  error
+}
+
+func scanListForSortedSearch(ctx context.Context, db DB, query *SearchQuery, listIndex int, cursor *sortedSearchRow, limit int) *sortedListScan {
+	list := query.Lists[listIndex]
+	scan := &sortedListScan{}
+	err := db.ReadEachRowInRange(list, &query.KeyRange, func(r *Row) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, ok := query.matchRow(list, r); !ok {
+			return nil
+		}
+		row := &sortedSearchRow{value: newSearchSortValue(query.Sort, list, r), list: listIndex, key: r.Key}
+		if cursor != nil && compareSortedSearchRows(query.Sort, row, cursor) <= 0 {
+			return nil // already returned in a previous page
+		}
+		row.key = append(RowKey{}, r.Key...) // only the key and sort value are kept while scanning
+		scan.rows = append(scan.rows, row)
+		if len(scan.rows) > 2*(limit+1) {
+			scan.rows = sortAndTruncate(query.Sort, scan.rows, limit+1)
+		}
+		return nil
+	})
+	scan.done, scan.err = searchScanStatus(ctx, err)
+	return scan
+}
@@ -0,0 +1,98 @@
+package kvstore
+
+import "time"
+
+// ListStats holds low-level storage statistics of a list.
+// Stats of nested lists are included in the stats of their parent.
+type ListStats struct {
+	// Page counts
+	BranchPageN     int `json:"branch_page_n"`     // number of logical branch pages
+	BranchOverflowN int `json:"branch_overflow_n"` // number of physical branch overflow pages
+	LeafPageN       int `json:"leaf_page_n"`       // number of logical leaf pages
+	LeafOverflowN   int `json:"leaf_overflow_n"`   // number of physical leaf overflow pages
+
+	// Tree statistics
+	KeyN  int `json:"key_n"` // number of keys (including nested lists)
+	Depth int `json:"depth"` // number of levels in the B+tree
+
+	// Page size utilization
+	BranchAlloc int `json:"branch_alloc"` // bytes allocated for physical branch pages
+	BranchInuse int `json:"branch_inuse"` // bytes actually used for branch data
+	LeafAlloc   int `json:"leaf_alloc"`   // bytes allocated for physical leaf pages
+	LeafInuse   int `json:"leaf_inuse"`   // bytes actually used for leaf data
+
+	// Nested lists statistics
+	BucketN           int `json:"bucket_n"`            // total number of lists (including this one)
+	InlineBucketN     int `json:"inline_bucket_n"`     // number of lists stored inline in their parent's page
+	InlineBucketInuse int `json:"inline_bucket_inuse"` // bytes used by inline lists
+}
+
+// Utilization returns the percentage of allocated page bytes that are in use.
+func (s *ListStats) Utilization() float64 {
+	alloc := s.BranchAlloc + s.LeafAlloc
+	if alloc == 0 {
+		return 0
+	}
+	return float64(s.BranchInuse+s.LeafInuse) / float64(alloc) * 100
+}
+
+// DBStats holds DB-wide storage and transaction statistics (since the DB was opened).
+type DBStats struct {
+	PageSize int `json:"page_size"`
+
+	// Freelist stats
+	FreePageN     int `json:"free_page_n"`    // number of free pages on the freelist
+	PendingPageN  int `json:"pending_page_n"` // number of pages that will be free once older read transactions are closed
+	FreeAlloc     int `json:"free_alloc"`     // bytes allocated in free and pending pages
+	FreelistInuse int `json:"freelist_inuse"` // bytes used by the freelist
+
+	// Transaction stats
+	TxN     int `json:"tx_n"`      // number of started read transactions
+	OpenTxN int `json:"open_tx_n"` // number of currently open read transactions
+
+	// Write transaction stats
+	PageCount int64         `json:"page_count"` // number of page allocations
+	PageAlloc int64         `json:"page_alloc"` // bytes allocated
+	Rebalance int64         `json:"rebalance"`  // number of node rebalances
+	Split     int64         `json:"split"`      // number of nodes split
+	Spill     int64         `json:"spill"`      // number of nodes spilled
+	Write     int64         `json:"write"`      // number of page writes
+	WriteTime time.Duration `json:"write_time"` // total time spent writing to disk
+}
+
+// Sizes used by bbolt to store rows in leaf pages.
+const (
+	leafPageHeaderSize  = 16
+	leafElementSize     = 16
+	nestedListValueSize = 16 // root page ID and sequence
+)
+
+// EstimateListInfo estimates the number of rows and their size from the list stats (without reading rows).
+// Stats of the direct children (by name) are subtracted from the stats of their parent.
+func EstimateListInfo(path ListPath, stats *ListStats, children map[string]*ListStats) *ListInfo {
+	info := &ListInfo{Path: path, Stats: stats}
+
+	keyN, leafPageN, leafInuse := stats.KeyN, stats.LeafPageN, stats.LeafInuse
+	if leafPageN == 0 {
+		// Small lists are stored inline (in the value of their parent) and don't have nested lists
+		leafPageN, leafInuse = 1, stats.InlineBucketInuse
+	}
+	for name, childStats := range children {
+		keyN -= childStats.KeyN + 1
+		leafPageN -= childStats.LeafPageN
+		leafInuse -= childStats.LeafInuse + leafElementSize + len(name) + nestedListValueSize
+		if childStats.LeafPageN == 0 {
+			leafInuse -= childStats.InlineBucketInuse
+		}
+	}
+	if keyN > 0 {
+		info.NumRows = uint64(keyN)
+	}
+	if size := leafInuse - leafPageN*leafPageHeaderSize - keyN*leafElementSize; size > 0 {
+		info.TotalRowSize = uint64(size)
+	}
+	if info.NumRows != 0 {
+		info.AvgRowSize = info.TotalRowSize / info.NumRows
+	}
+	return info
+}